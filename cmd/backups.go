@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sukauto/controler"
+)
+
+// offline config backups management: sukauto backup list|restore
+type backupCommand struct {
+	List    backupListCommand    `command:"list" description:"List config backups, newest first"`
+	Restore backupRestoreCommand `command:"restore" description:"Restore config from backup"`
+}
+
+type backupListCommand struct{}
+
+func (cmd *backupListCommand) Execute([]string) error {
+	backups, err := openBackups().Backups()
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		fmt.Printf("%s\t%s\t%d\n", backup.Revision, backup.Time.Local().Format("2006-01-02 15:04:05"), backup.Size)
+	}
+	return nil
+}
+
+type backupRestoreCommand struct {
+	Args struct {
+		Revision string `positional-arg-name:"revision" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (cmd *backupRestoreCommand) Execute([]string) error {
+	return openBackups().Restore(cmd.Args.Revision)
+}
+
+// openBackups works with config file only, so broken config can be restored offline
+func openBackups() controler.BackupManager {
+	return controler.NewConfigBackups(config.ConfigFile, config.ConfigBackups)
+}
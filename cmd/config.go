@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"sukauto/controler"
+)
+
+// offline config management: sukauto config validate
+type configCommand struct {
+	Validate configValidateCommand `command:"validate" description:"Check config file for unknown keys and inconsistencies"`
+}
+
+type configValidateCommand struct {
+	Args struct {
+		File string `positional-arg-name:"file" description:"Config file (default is --config-file)"`
+	} `positional-args:"yes"`
+}
+
+func (cmd *configValidateCommand) Execute([]string) error {
+	file := cmd.Args.File
+	if file == "" {
+		file = config.ConfigFile
+	}
+	problems, err := controler.ValidateConfigFile(file)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(problems), file)
+	}
+	fmt.Println(file, "is valid")
+	return nil
+}
@@ -4,40 +4,107 @@ import (
 	"fmt"
 	"github.com/jessevdk/go-flags"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sukauto/controler"
 	"sukauto/integration"
 	"sukauto/integration/tg"
 	"sukauto/utils"
+	"syscall"
 	"time"
 )
 
 var config struct {
-	Bind          string                 `long:"bind" env:"BIND" description:"Binding address" default:":8080"`
-	ConfigFile    string                 `long:"config-file" env:"CONFIG_FILE" description:"Path to configuration file" default:"config.json"`
-	UpdCmd        string                 `long:"updcmd" env:"UPDCMD" description:"command for update" default:"git pull origin master"`
-	CORS          integration.CorsConfig `group:"cors" env-namespace:"CORS" namespace:"cors"`
-	CheckInterval time.Duration          `long:"check-interval" env:"CHECK_INTERVAL" description:"Background check interval" default:"15s"`
-	StatusScript  string                 `long:"status-script" env:"STATUS_SCRIPT" description:"Script to run for services events"`
+	Bind          string                    `long:"bind" env:"BIND" description:"Binding address" default:":8080"`
+	ConfigFile    string                    `long:"config-file" env:"CONFIG_FILE" description:"Path to configuration file" default:"config.json"`
+	ConfigBackups int                       `long:"config-backups" env:"CONFIG_BACKUPS" description:"Number of config backups to keep (0 - disabled)" default:"10"`
+	ConfigWatch   time.Duration             `long:"config-watch" env:"CONFIG_WATCH" description:"Interval to check configuration file for changes (0 - reload on SIGHUP only)" default:"5s"`
+	UpdCmd        string                    `long:"updcmd" env:"UPDCMD" description:"command for update" default:"git pull origin master"`
+	Backend       string                    `long:"backend" env:"BACKEND" description:"Services management backend" default:"systemctl" choice:"systemctl" choice:"dbus" choice:"supervisor" choice:"docker"`
+	DockerSocket  string                    `long:"docker-socket" env:"DOCKER_SOCKET" description:"Docker engine socket for docker backend" default:"/var/run/docker.sock"`
+	CORS          integration.CorsConfig    `group:"cors" env-namespace:"CORS" namespace:"cors"`
+	Audit         integration.AuditConfig   `group:"audit" env-namespace:"AUDIT" namespace:"audit"`
+	Session       integration.SessionConfig `group:"session" env-namespace:"SESSION" namespace:"session"`
+	Guard         integration.GuardConfig   `group:"guard" env-namespace:"GUARD" namespace:"guard"`
+	TLS           integration.TLSConfig     `group:"tls"`
+	Unix          integration.UnixConfig    `group:"unix socket"`
+	Access        integration.AccessConfig  `group:"access" env-namespace:"ACCESS" namespace:"access"`
+	CheckInterval time.Duration             `long:"check-interval" env:"CHECK_INTERVAL" description:"Background check interval" default:"15s"`
+	StatusScript  string                    `long:"status-script" env:"STATUS_SCRIPT" description:"Script to run for services events"`
+	HistoryFile   string                    `long:"history-file" env:"HISTORY_FILE" description:"File to keep events history (empty - disabled)" default:"events.jsonl"`
+	HistorySize   int64                     `long:"history-max-size" env:"HISTORY_MAX_SIZE" description:"Max size of events history file in bytes before rotation" default:"10485760"`
+	HistoryKeep   int                       `long:"history-keep" env:"HISTORY_KEEP" description:"Number of rotated events history files to keep" default:"5"`
 	// plugins
 	Telegram tg.ExtraTelegram `group:"telegram plugin" env-namespace:"TG" namespace:"tg"`
+	// commands
+	User   userCommand   `command:"user" description:"Manage users offline"`
+	Backup backupCommand `command:"backup" description:"Manage config backups offline"`
+	Config configCommand `command:"config" description:"Check config offline"`
 }
 
 func main() {
-	_, err := flags.Parse(&config)
+	parser := flags.NewParser(&config, flags.Default)
+	parser.SubcommandsOptional = true
+	_, err := parser.Parse()
 	if err != nil {
 		os.Exit(1)
 	}
-	fmt.Println(utils.Logo)
+	if parser.Active != nil {
+		// command already executed
+		return
+	}
+	fmt.Print(utils.Logo)
 	fmt.Println("SUKAUTO - monitoring system")
-	monitor := controler.NewServiceControllerByPath(config.ConfigFile, config.UpdCmd)
+	var monitor controler.AccessServiceController
+	switch config.Backend {
+	case "dbus":
+		monitor = controler.NewServiceControllerWithBackend(config.ConfigFile, config.UpdCmd, controler.NewDBusBackend(controler.SystemExecutor{}))
+	case "supervisor":
+		supervisor, err := controler.NewSupervisor(filepath.Join(filepath.Dir(config.ConfigFile), controler.SupervisorStateFile))
+		if err != nil {
+			panic(err)
+		}
+		monitor = controler.NewServiceControllerWithBackend(config.ConfigFile, config.UpdCmd, supervisor)
+	case "docker":
+		monitor = controler.NewServiceControllerWithBackend(config.ConfigFile, config.UpdCmd, controler.NewDockerBackend(config.DockerSocket))
+	default:
+		monitor = controler.NewServiceControllerByPath(config.ConfigFile, config.UpdCmd)
+	}
+	monitor.KeepBackups(config.ConfigBackups)
+	// reload config on change
+	if config.ConfigWatch > 0 {
+		go monitor.Watch(config.ConfigWatch)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := monitor.Reload(); err != nil {
+				log.Println("reload config:", err)
+				continue
+			}
+			log.Println("config reloaded")
+		}
+	}()
 	// setup listeners
 	events := monitor.Events()
 	events = controler.WithBackgroundCheck(events, config.CheckInterval, monitor)
 	events = controler.WithStateFilter(events)
+	var history *controler.History
+	if config.HistoryFile != "" {
+		history = controler.NewHistory(config.HistoryFile, config.HistorySize, config.HistoryKeep)
+		events = controler.WithHistory(events, history)
+	}
 	if config.StatusScript != "" {
 		events = controler.WithScriptRunner(events, config.StatusScript)
 	}
+	auditLog := config.Audit.Open()
+	guard, err := config.Guard.Open()
+	if err != nil {
+		panic(err)
+	}
 	// ....
 	out, drain := controler.Tee(events)
 	go func() {
@@ -50,7 +117,7 @@ func main() {
 		out, tgEvents := controler.Tee(events)
 		// plugins
 		go func() {
-			if err := config.Telegram.Run(monitor, tgEvents); err != nil {
+			if err := config.Telegram.Run(monitor, tgEvents, auditLog, guard.Attempts()); err != nil {
 				log.Println("telegram plugin failed:", err)
 			}
 		}()
@@ -58,8 +125,28 @@ func main() {
 	}
 
 	// setup integration
-	var access controler.Access = monitor
-	router := integration.NewHTTP(monitor, access, config.CORS, events)
+	access, err := config.Access.Open(monitor)
+	if err != nil {
+		panic(err)
+	}
+	sessions, err := integration.NewSessions(config.Session)
+	if err != nil {
+		panic(err)
+	}
+	router := integration.NewHTTP(monitor, access, config.CORS, events, history, auditLog, sessions, guard)
 
-	panic(router.Run(config.Bind))
+	if config.Unix.Socket != "" {
+		go func() {
+			panic(config.Unix.Serve(router))
+		}()
+	}
+	tlsConfig, err := config.TLS.Server()
+	if err != nil {
+		panic(err)
+	}
+	if tlsConfig == nil {
+		panic(router.Run(config.Bind))
+	}
+	server := &http.Server{Addr: config.Bind, Handler: router, TLSConfig: tlsConfig}
+	panic(server.ListenAndServeTLS("", ""))
 }
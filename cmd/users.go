@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"strings"
+	"sukauto/controler"
+)
+
+// offline users management: sukauto user add|remove|passwd|list
+type userCommand struct {
+	Add    userAddCommand    `command:"add" description:"Add user"`
+	Remove userRemoveCommand `command:"remove" description:"Remove user"`
+	Passwd userPasswdCommand `command:"passwd" description:"Change password of user"`
+	List   userListCommand   `command:"list" description:"List users"`
+}
+
+type userArgs struct {
+	Name string `positional-arg-name:"name" required:"yes"`
+}
+
+type userAddCommand struct {
+	Password string   `long:"password" env:"PASSWORD" description:"User password (read from stdin if not set)"`
+	Args     userArgs `positional-args:"yes"`
+}
+
+func (cmd *userAddCommand) Execute([]string) error {
+	users := openUsers()
+	for _, name := range users.UserNames() {
+		if name == cmd.Args.Name {
+			return errors.New("user already exists")
+		}
+	}
+	password, err := readPassword(cmd.Password)
+	if err != nil {
+		return err
+	}
+	return users.SetPassword(cmd.Args.Name, password)
+}
+
+type userRemoveCommand struct {
+	Args userArgs `positional-args:"yes"`
+}
+
+func (cmd *userRemoveCommand) Execute([]string) error {
+	return openUsers().RemoveUser(cmd.Args.Name)
+}
+
+type userPasswdCommand struct {
+	Password string   `long:"password" env:"PASSWORD" description:"New password (read from stdin if not set)"`
+	Args     userArgs `positional-args:"yes"`
+}
+
+func (cmd *userPasswdCommand) Execute([]string) error {
+	users := openUsers()
+	var exists bool
+	for _, name := range users.UserNames() {
+		exists = exists || name == cmd.Args.Name
+	}
+	if !exists {
+		return errors.New("user not exists")
+	}
+	password, err := readPassword(cmd.Password)
+	if err != nil {
+		return err
+	}
+	return users.SetPassword(cmd.Args.Name, password)
+}
+
+type userListCommand struct{}
+
+func (cmd *userListCommand) Execute([]string) error {
+	for _, name := range openUsers().UserNames() {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+func openUsers() controler.UserManager {
+	monitor := controler.NewServiceControllerByPath(config.ConfigFile, config.UpdCmd)
+	monitor.KeepBackups(config.ConfigBackups)
+	return monitor
+}
+
+// readPassword returns provided password or reads it from terminal (without echo) or stdin
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		data, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
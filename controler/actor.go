@@ -0,0 +1,75 @@
+package controler
+
+// Origins of events
+const (
+	OriginAPI        = "api"
+	OriginTelegram   = "telegram"
+	OriginBackground = "background"
+	OriginConfig     = "config" // changes of config file
+)
+
+// Actor who initiated operation
+type Actor struct {
+	Name   string // HTTP user name, telegram user id, ...
+	Origin string
+}
+
+// Direct calls have no actor
+
+func (cfg *Conf) Restart(name string) error       { return cfg.restart(name, Actor{}) }
+func (cfg *Conf) Run(name string) error           { return cfg.run(name, Actor{}) }
+func (cfg *Conf) Stop(name string) error          { return cfg.stop(name, Actor{}) }
+func (cfg *Conf) Update(name string) error        { return cfg.update(name, Actor{}) }
+func (cfg *Conf) Create(service NewService) error { return cfg.create(service, Actor{}) }
+func (cfg *Conf) Attach(name string) error        { return cfg.attach(name, Actor{}) }
+func (cfg *Conf) Enable(name string) error        { return cfg.enable(name, Actor{}) }
+func (cfg *Conf) Disable(name string) error       { return cfg.disable(name, Actor{}) }
+func (cfg *Conf) Forget(name string) error        { return cfg.forget(name, Actor{}) }
+func (cfg *Conf) Restore(revision string) error   { return cfg.restore(revision, Actor{}) }
+func (cfg *Conf) Reinstall(name string) error     { return cfg.reinstall(name, Actor{}) }
+func (cfg *Conf) Join(groupName, serviceName string) error {
+	return cfg.join(groupName, serviceName, Actor{})
+}
+func (cfg *Conf) Leave(groupName, serviceName string) error {
+	return cfg.leave(groupName, serviceName, Actor{})
+}
+func (cfg *Conf) Modify(service NewService, restart bool) (ServiceChange, error) {
+	return cfg.modify(service, restart, Actor{})
+}
+func (cfg *Conf) Remove(name string, options RemoveOptions) (string, error) {
+	return cfg.remove(name, options, Actor{})
+}
+
+func (cfg *Conf) As(actor string, origin string) ServiceController {
+	return &actorController{Conf: cfg, actor: Actor{Name: actor, Origin: origin}}
+}
+
+// actorController is a view of Conf which emits events on behalf of actor
+type actorController struct {
+	*Conf
+	actor Actor
+}
+
+func (ac *actorController) Restart(name string) error       { return ac.restart(name, ac.actor) }
+func (ac *actorController) Run(name string) error           { return ac.run(name, ac.actor) }
+func (ac *actorController) Stop(name string) error          { return ac.stop(name, ac.actor) }
+func (ac *actorController) Update(name string) error        { return ac.update(name, ac.actor) }
+func (ac *actorController) Create(service NewService) error { return ac.create(service, ac.actor) }
+func (ac *actorController) Attach(name string) error        { return ac.attach(name, ac.actor) }
+func (ac *actorController) Enable(name string) error        { return ac.enable(name, ac.actor) }
+func (ac *actorController) Disable(name string) error       { return ac.disable(name, ac.actor) }
+func (ac *actorController) Forget(name string) error        { return ac.forget(name, ac.actor) }
+func (ac *actorController) Restore(revision string) error   { return ac.restore(revision, ac.actor) }
+func (ac *actorController) Reinstall(name string) error     { return ac.reinstall(name, ac.actor) }
+func (ac *actorController) Join(groupName, serviceName string) error {
+	return ac.join(groupName, serviceName, ac.actor)
+}
+func (ac *actorController) Leave(groupName, serviceName string) error {
+	return ac.leave(groupName, serviceName, ac.actor)
+}
+func (ac *actorController) Modify(service NewService, restart bool) (ServiceChange, error) {
+	return ac.modify(service, restart, ac.actor)
+}
+func (ac *actorController) Remove(name string, options RemoveOptions) (string, error) {
+	return ac.remove(name, options, ac.actor)
+}
@@ -0,0 +1,41 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to temporary file in the same directory, syncs it and renames to location,
+// so location has either old or new content even after crash
+func writeFileAtomic(location string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(location)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(location)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), location); err != nil {
+		return err
+	}
+	// persist rename
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
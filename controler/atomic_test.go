@@ -0,0 +1,30 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "config.json")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(location, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadFile(location)
+		if string(data) != content {
+			t.Error("unexpected content:", string(data))
+		}
+	}
+	info, _ := os.Stat(location)
+	if info.Mode().Perm() != 0600 {
+		t.Error("unexpected permissions:", info.Mode())
+	}
+}
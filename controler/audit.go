@@ -0,0 +1,98 @@
+package controler
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditFile    = "audit.jsonl"
+	AuditOK      = "ok"
+	AuditError   = "error"
+	AuditDenied  = "denied"
+	auditMaxSize = 10 * 1024 * 1024
+	auditKeep    = 5
+)
+
+// AuditRecord describes one mutating operation
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user,omitempty"`
+	Token  string    `json:"token,omitempty"`  // name of API token if operation is made by token
+	Source string    `json:"source,omitempty"` // IP address or telegram chat id
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Result string    `json:"result"` // ok, error, denied
+	Error  string    `json:"error,omitempty"`
+}
+
+// AuditFilter for audit log query. Zero fields mean no filtering
+type AuditFilter struct {
+	User   string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// AuditPage is a part of matched records (newest first) and total number of matched records
+type AuditPage struct {
+	Records []AuditRecord `json:"records"`
+	Total   int           `json:"total"`
+}
+
+// AuditLog is an append-only JSONL log of operations. When file exceeds max size it is rotated:
+// audit.jsonl -> audit.jsonl.1 -> ... -> audit.jsonl.N (removed)
+type AuditLog struct {
+	log rotatingLog
+}
+
+// NewAuditLog creates audit log. Non-positive max size (bytes) and keep (number of rotated files) mean defaults
+func NewAuditLog(location string, maxSize int64, keep int) *AuditLog {
+	if maxSize <= 0 {
+		maxSize = auditMaxSize
+	}
+	if keep <= 0 {
+		keep = auditKeep
+	}
+	return &AuditLog{log: rotatingLog{location: location, maxSize: maxSize, keep: keep}}
+}
+
+// Record appends record to the log and rotates file if needed. Zero time is replaced by current time
+func (al *AuditLog) Record(record AuditRecord) error {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	return al.log.append(record)
+}
+
+// Query records by filter. Records are ordered from newest to oldest
+func (al *AuditLog) Query(filter AuditFilter) (AuditPage, error) {
+	ans := AuditPage{Records: make([]AuditRecord, 0)}
+	page, total, err := al.log.page(filter.Offset, filter.Limit, func(line []byte) (interface{}, bool) {
+		var record AuditRecord
+		if json.Unmarshal(line, &record) != nil {
+			return nil, false
+		}
+		return record, filter.match(record)
+	})
+	ans.Total = total
+	for _, record := range page {
+		ans.Records = append(ans.Records, record.(AuditRecord))
+	}
+	return ans, err
+}
+
+func (filter *AuditFilter) match(record AuditRecord) bool {
+	if !filter.From.IsZero() && record.Time.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && record.Time.After(filter.To) {
+		return false
+	}
+	return (filter.User == "" || filter.User == record.User) &&
+		(filter.Action == "" || filter.Action == record.Action) &&
+		(filter.Target == "" || filter.Target == record.Target)
+}
@@ -0,0 +1,48 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, AuditFile)
+	// small size to rotate after each record
+	auditLog := NewAuditLog(location, 1, 2)
+	records := []AuditRecord{
+		{User: "alice", Source: "127.0.0.1", Action: "stop", Target: "web", Result: AuditOK},
+		{User: "bob", Source: "10.0.0.2", Action: "update", Target: "web", Result: AuditError, Error: "exit status 1"},
+		{User: "alice", Source: "127.0.0.1", Action: "forget", Target: "db", Result: AuditOK},
+		{User: "42", Source: "-100500", Action: "restart", Target: "web", Result: AuditOK},
+	}
+	for _, record := range records {
+		if err := auditLog.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// current file and 2 rotated, the oldest one is dropped
+	if _, err := os.Stat(location + ".3"); !os.IsNotExist(err) {
+		t.Error("too many rotated files")
+	}
+	page, err := auditLog.Query(AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || page.Records[0].User != "42" || page.Records[2].User != "bob" {
+		t.Error("unexpected records:", page)
+	}
+	page, err = auditLog.Query(AuditFilter{Target: "web", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Records) != 1 || page.Records[0].Action != "restart" || page.Records[0].Time.IsZero() {
+		t.Error("unexpected records:", page)
+	}
+}
@@ -0,0 +1,154 @@
+package controler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Backend performs low-level operations over services. Conf keeps configuration, groups and events
+// and delegates to backend everything that touches real services
+type Backend interface {
+	// Control executes operation (start, stop, restart, enable, disable) over service
+	Control(name string, operation string, user bool) error
+	// Properties of service (systemd names: SubState, WorkingDirectory, ...). Unknown fields are empty
+	Properties(name string, fields []string, user bool) (map[string]string, error)
+	// Log returns last lines of service output
+	Log(name string, user bool) (string, error)
+}
+
+// Installer is optional Backend extension for backends which keep services definitions by themselves.
+// Backends without it get systemd unit file generated from the definition
+type Installer interface {
+	Install(service NewService, user bool) error
+}
+
+// Uninstaller is optional extension of Installer to remove service definition
+type Uninstaller interface {
+	Uninstall(name string, user bool) error
+}
+
+// Updater is optional Backend extension for backends with own update procedure instead of update command
+type Updater interface {
+	Update(name string, user bool) error
+}
+
+// UnitReloader is optional Backend extension for backends which should reload unit files after they are changed
+type UnitReloader interface {
+	DaemonReload(user bool) error
+}
+
+// BatchBackend is optional Backend extension to query properties of many services at once
+type BatchBackend interface {
+	// PropertiesAll returns properties of each service by name
+	PropertiesAll(names []string, fields []string, user bool) (map[string]map[string]string, error)
+}
+
+type systemctlBackend struct {
+	executor Executor
+}
+
+// NewSystemctlBackend creates backend which runs systemctl and journalctl through provided executor
+func NewSystemctlBackend(executor Executor) Backend {
+	return &systemctlBackend{executor: executor}
+}
+
+func (sb *systemctlBackend) Control(name string, operation string, user bool) error {
+	_, err := control(sb.executor, name, operation, user)
+	return err
+}
+
+func (sb *systemctlBackend) Properties(name string, fields []string, user bool) (map[string]string, error) {
+	return controlQueryFields(sb.executor, name, fields, user)
+}
+
+func (sb *systemctlBackend) PropertiesAll(names []string, fields []string, user bool) (map[string]map[string]string, error) {
+	return controlQueryMany(sb.executor, names, fields, user)
+}
+
+func (sb *systemctlBackend) DaemonReload(user bool) error {
+	var args []string
+	if user {
+		args = append(args, ModeUser)
+	}
+	_, err := sb.executor.Execute("", COMMAND, append(args, CmdReload)...)
+	return err
+}
+
+func (sb *systemctlBackend) Log(name string, user bool) (string, error) {
+	return journal(sb.executor, name, user)
+}
+
+func control(executor Executor, name string, operation string, user bool) (string, error) {
+	var args []string
+	if user {
+		args = append(args, ModeUser)
+	}
+	args = append(args, operation, name)
+	return executor.Execute("", COMMAND, args...)
+}
+
+func journal(executor Executor, name string, user bool) (string, error) {
+	var args = []string{ModeMergeJournals, ModeNoPages, ModeQuite, ModeLimit, strconv.Itoa(LogLimit)}
+	if user {
+		args = append(args, ModeUserUnit)
+	} else {
+		args = append(args, ModeSystemUnit)
+	}
+	args = append(args, name)
+	res, err := executor.Execute("", JournalCommand, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(res), nil
+}
+
+func controlQueryFields(executor Executor, name string, fields []string, user bool) (map[string]string, error) {
+	var args []string
+	if user {
+		args = append(args, ModeUser)
+	}
+	args = append(args, CmdShow, "-p", strings.Join(fields, ","), name)
+	res, err := executor.Execute("", COMMAND, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseProperties(res), nil
+}
+
+// controlQueryMany queries properties of all units by single systemctl call. Output contains one block of
+// properties per unit separated by empty line in the same order as units
+func controlQueryMany(executor Executor, names []string, fields []string, user bool) (map[string]map[string]string, error) {
+	var args []string
+	if user {
+		args = append(args, ModeUser)
+	}
+	args = append(args, CmdShow, "-p", strings.Join(fields, ","))
+	args = append(args, names...)
+	res, err := executor.Execute("", COMMAND, args...)
+	if err != nil {
+		return nil, err
+	}
+	blocks := strings.Split(strings.TrimSpace(res), "\n\n")
+	if len(blocks) != len(names) {
+		return nil, fmt.Errorf("expected properties of %d units, got %d", len(names), len(blocks))
+	}
+	ans := make(map[string]map[string]string, len(names))
+	for i, name := range names {
+		ans[name] = parseProperties(blocks[i])
+	}
+	return ans, nil
+}
+
+// parse Key=Value lines of systemctl show output
+func parseProperties(text string) map[string]string {
+	ans := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		ans[kv[0]] = strings.TrimSpace(kv[1])
+	}
+	return ans
+}
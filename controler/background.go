@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
 	"time"
 )
 
@@ -18,12 +19,15 @@ func WithBackgroundCheck(events <-chan SystemEvent, interval time.Duration, cont
 			select {
 			case <-ticker.C:
 				statuses := controller.RefreshStatus()
+				now := time.Now()
 				for _, status := range statuses.Services {
+					event := SystemEvent{Type: EventStopped, Name: status.Name, Time: now, Origin: OriginBackground}
 					if status.Status == "running" {
-						ans <- SystemEvent{Type: EventStarted, Name: status.Name}
+						event.Type = EventStarted
 					} else {
-						ans <- SystemEvent{Type: EventStopped, Name: status.Name}
+						event.Details = describeStop(status)
 					}
+					ans <- event
 				}
 			case event, ok := <-events:
 				if !ok {
@@ -47,6 +51,10 @@ func WithScriptRunner(events <-chan SystemEvent, command string) <-chan SystemEv
 			cmd.Stdout = os.Stdout
 			cmd.Env = append(cmd.Env, EnvService+"="+event.Name)
 			cmd.Env = append(cmd.Env, EnvEvent+"="+event.Type.String())
+			cmd.Env = append(cmd.Env, EnvTime+"="+event.Time.Format(time.RFC3339))
+			cmd.Env = append(cmd.Env, EnvActor+"="+event.Actor)
+			cmd.Env = append(cmd.Env, EnvOrigin+"="+event.Origin)
+			cmd.Env = append(cmd.Env, EnvDetails+"="+event.Details)
 			if err := cmd.Run(); err != nil {
 				log.Println("failed run script", command, ":", err)
 			}
@@ -56,6 +64,15 @@ func WithScriptRunner(events <-chan SystemEvent, command string) <-chan SystemEv
 	return ans
 }
 
+// describeStop explains why service is not running, e.g.: failed, exit code 1
+func describeStop(status ServiceStatus) string {
+	details := status.Status
+	if status.ExitCode != 0 {
+		details += ", exit code " + strconv.Itoa(status.ExitCode)
+	}
+	return details
+}
+
 func Tee(events <-chan SystemEvent) (<-chan SystemEvent, <-chan SystemEvent) {
 	a, b := make(chan SystemEvent), make(chan SystemEvent)
 	go func() {
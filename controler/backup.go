@@ -0,0 +1,169 @@
+package controler
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultBackups is a number of config backups kept by default
+const DefaultBackups = 10
+
+const revisionLayout = "20060102T150405.000000000Z"
+
+var ErrUnknownBackup = errors.New("unknown backup")
+
+// Backup is a previous revision of config file
+type Backup struct {
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+	Size     int64     `json:"size"`
+}
+
+// BackupManager manages backups of config file. Backup of previous config is made on each change
+type BackupManager interface {
+	// Backups of config, newest first
+	Backups() ([]Backup, error)
+	// Restore config from backup. Current config is backed up too, so restore can be undone
+	Restore(revision string) error
+}
+
+// ConfigBackups manages backups of config file by its location only, so it works even if config is broken
+type ConfigBackups struct {
+	location string
+	keep     int
+}
+
+// NewConfigBackups of config file. Restore keeps at most keep backups
+func NewConfigBackups(location string, keep int) *ConfigBackups {
+	return &ConfigBackups{location: location, keep: keep}
+}
+
+func (cb *ConfigBackups) Backups() ([]Backup, error) {
+	files, err := filepath.Glob(cb.location + ".*")
+	if err != nil {
+		return nil, err
+	}
+	ans := make([]Backup, 0, len(files))
+	for _, file := range files {
+		revision := strings.TrimPrefix(file, cb.location+".")
+		stamp, err := time.Parse(revisionLayout, revision)
+		if err != nil {
+			// temporary or unrelated file
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		ans = append(ans, Backup{Revision: revision, Time: stamp, Size: info.Size()})
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		return ans[i].Time.After(ans[j].Time)
+	})
+	return ans, nil
+}
+
+// Restore config file from valid backup. Current config is not loaded, it is only backed up
+func (cb *ConfigBackups) Restore(revision string) error {
+	data, err := cb.read(revision)
+	if err != nil {
+		return err
+	}
+	return cb.write(data)
+}
+
+// read content of backup and check that it is a valid config
+func (cb *ConfigBackups) read(revision string) ([]byte, error) {
+	backups, err := cb.Backups()
+	if err != nil {
+		return nil, err
+	}
+	var found bool
+	for _, backup := range backups {
+		found = found || backup.Revision == revision
+	}
+	if !found {
+		return nil, ErrUnknownBackup
+	}
+	data, err := ioutil.ReadFile(cb.location + "." + revision)
+	if err != nil {
+		return nil, err
+	}
+	jData, err := formatOf(cb.location).toJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var restored Conf
+	if _, err := decodeConfig(jData, &restored); err != nil {
+		return nil, err
+	}
+	if err := restored.validate(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// write config file atomically. Previous content is kept as a backup
+func (cb *ConfigBackups) write(data []byte) error {
+	if previous, err := ioutil.ReadFile(cb.location); err == nil && cb.keep > 0 && !bytes.Equal(previous, data) {
+		revision := time.Now().UTC().Format(revisionLayout)
+		if err := writeFileAtomic(cb.location+"."+revision, previous, 0600); err != nil {
+			return err
+		}
+		if err := cb.prune(); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(cb.location, data, 0600)
+}
+
+// prune removes the oldest backups over the limit
+func (cb *ConfigBackups) prune() error {
+	backups, err := cb.Backups()
+	if err != nil {
+		return err
+	}
+	for i := cb.keep; i < len(backups); i++ {
+		if err := os.Remove(cb.location + "." + backups[i].Revision); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *Conf) KeepBackups(keep int) {
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	cfg.backups = keep
+}
+
+func (cfg *Conf) Backups() ([]Backup, error) {
+	return NewConfigBackups(cfg.location, 0).Backups()
+}
+
+func (cfg *Conf) restore(revision string, by Actor) error {
+	data, err := NewConfigBackups(cfg.location, 0).read(revision)
+	if err != nil {
+		return err
+	}
+	cfg.lock.Lock()
+	err = cfg.writeUnsafe(data)
+	cfg.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	return cfg.reload(by, "restored from backup "+revision)
+}
+
+// writeUnsafe replaces config file atomically. Previous content is kept as a backup
+func (cfg *Conf) writeUnsafe(data []byte) error {
+	err := NewConfigBackups(cfg.location, cfg.backups).write(data)
+	cfg.file.seen(cfg.location)
+	return err
+}
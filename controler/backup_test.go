@@ -0,0 +1,108 @@
+package controler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestConf_Restore(t *testing.T) {
+	controller, _, events := newTestController(t)
+	for _, name := range []string{"web", "db"} {
+		if err := controller.Attach(name); err != nil {
+			t.Fatal("attach:", err)
+		}
+		<-events
+	}
+	if err := controller.Forget("db"); err != nil {
+		t.Fatal("forget:", err)
+	}
+	<-events
+
+	backups, err := controller.Backups()
+	if err != nil {
+		t.Fatal("backups:", err)
+	}
+	if len(backups) != 3 {
+		t.Fatal("unexpected number of backups:", len(backups))
+	}
+	// undo forget
+	if err := controller.Restore(backups[0].Revision); err != nil {
+		t.Fatal("restore:", err)
+	}
+	if event := <-events; event.Type != EventCreated || event.Name != "db" {
+		t.Error("unexpected event:", event)
+	}
+	if services := controller.(*Conf).Services; len(services) != 2 {
+		t.Error("unexpected services after restore:", services)
+	}
+	if backups, _ := controller.Backups(); len(backups) != 4 {
+		t.Error("restore is not backed up:", len(backups))
+	}
+	if err := controller.Restore("../config.json"); err != ErrUnknownBackup {
+		t.Error("restore of unknown backup:", err)
+	}
+}
+
+func TestConf_KeepBackups(t *testing.T) {
+	controller, _, events := newTestController(t)
+	controller.KeepBackups(2)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := controller.Attach(name); err != nil {
+			t.Fatal("attach:", err)
+		}
+		<-events
+	}
+	backups, err := controller.Backups()
+	if err != nil {
+		t.Fatal("backups:", err)
+	}
+	if len(backups) != 2 || !backups[0].Time.After(backups[1].Time) {
+		t.Error("unexpected backups:", backups)
+	}
+	// no temporary files left
+	location := controller.(*Conf).location
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(location), "*"))
+	if len(files) != 3 {
+		t.Error("unexpected files:", files)
+	}
+}
+
+func TestConfigBackups_RestoreBrokenConfig(t *testing.T) {
+	controller, _, events := newTestController(t)
+	if err := controller.Attach("web"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	<-events
+	location := controller.(*Conf).location
+	if err := ioutil.WriteFile(location, []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(location+".20000101T000000.000000000Z", []byte(`{"services": ["web", "web"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	offline := NewConfigBackups(location, DefaultBackups)
+	backups, err := offline.Backups()
+	if err != nil {
+		t.Fatal("backups:", err)
+	}
+	if len(backups) != 2 {
+		t.Fatal("unexpected backups:", backups)
+	}
+	if err := offline.Restore(backups[1].Revision); err == nil {
+		t.Error("invalid backup restored")
+	}
+	if err := offline.Restore(backups[0].Revision); err != nil {
+		t.Fatal("restore:", err)
+	}
+	if problems, err := ValidateConfigFile(location); err != nil || len(problems) != 0 {
+		t.Error("restored config is invalid:", problems, err)
+	}
+	// broken config is kept too
+	backups, _ = offline.Backups()
+	data, _ := ioutil.ReadFile(location + "." + backups[0].Revision)
+	if len(backups) != 3 || string(data) != "{broken" {
+		t.Error("broken config is not backed up:", backups, string(data))
+	}
+}
@@ -0,0 +1,78 @@
+package controler
+
+import (
+	"sync"
+	"time"
+)
+
+// statusCache keeps last known statuses of services. It is fed by live queries (background check, actions)
+// and read by snapshots, so viewers don't cause systemd queries
+type statusCache struct {
+	lock     sync.RWMutex
+	statuses map[string]cachedStatus
+	updated  time.Time
+}
+
+type cachedStatus struct {
+	ServiceStatus
+	at time.Time
+}
+
+func (sc *statusCache) put(status ServiceStatus) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if sc.statuses == nil {
+		sc.statuses = make(map[string]cachedStatus)
+	}
+	sc.statuses[status.Name] = cachedStatus{ServiceStatus: status, at: time.Now()}
+}
+
+// merge statuses queried since provided time. Statuses put after that time are fresher and kept,
+// services which are not known anymore are dropped
+func (sc *statusCache) merge(statuses []ServiceStatus, since time.Time, known []string) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if sc.statuses == nil {
+		sc.statuses = make(map[string]cachedStatus, len(statuses))
+	}
+	for _, status := range statuses {
+		if cached, ok := sc.statuses[status.Name]; ok && cached.at.After(since) {
+			continue
+		}
+		sc.statuses[status.Name] = cachedStatus{ServiceStatus: status, at: since}
+	}
+	exists := make(map[string]bool, len(known))
+	for _, name := range known {
+		exists[name] = true
+	}
+	for name := range sc.statuses {
+		if !exists[name] {
+			delete(sc.statuses, name)
+		}
+	}
+	sc.updated = time.Now()
+}
+
+func (sc *statusCache) remove(name string) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	delete(sc.statuses, name)
+}
+
+// get cached status with actual uptime
+func (sc *statusCache) get(name string) (ServiceStatus, bool) {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+	cached, ok := sc.statuses[name]
+	status := cached.ServiceStatus
+	if ok && status.StartedAt != nil && status.Status == StateRunning {
+		status.Uptime = int64(time.Since(*status.StartedAt) / time.Second)
+	}
+	return status, ok
+}
+
+func (sc *statusCache) empty() bool {
+	sc.lock.RLock()
+	defer sc.lock.RUnlock()
+	return sc.updated.IsZero()
+}
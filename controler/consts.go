@@ -13,6 +13,7 @@ const (
 	CmdEnable      = "enable"
 	CmdDisable     = "disable"
 	CmdShow        = "show"
+	CmdReload      = "daemon-reload"
 	LogLimit       = 1024
 )
 
@@ -30,14 +31,35 @@ const (
 
 // Fields
 const (
-	FieldStatus = "SubState"
+	FieldStatus         = "SubState"
+	FieldActiveState    = "ActiveState"
+	FieldLoadState      = "LoadState"
+	FieldUnitFileState  = "UnitFileState"
+	FieldMainPID        = "MainPID"
+	FieldStartTimestamp = "ExecMainStartTimestamp"
+	FieldRestarts       = "NRestarts"
+	FieldExitStatus     = "ExecMainStatus"
+	FieldMemory         = "MemoryCurrent"
+	FieldCPU            = "CPUUsageNSec"
 )
 
+// StatusFields are queried for service status
+var StatusFields = []string{FieldStatus, FieldActiveState, FieldLoadState, FieldUnitFileState, FieldMainPID,
+	FieldStartTimestamp, FieldRestarts, FieldExitStatus, FieldMemory, FieldCPU}
+
 // Special states
 const (
 	StateUnknown = "unknown"
 )
 
+// Sub-states reported by built-in backends (the same as systemd ones)
+const (
+	StateRunning     = "running"
+	StateDead        = "dead"
+	StateFailed      = "failed"
+	StateAutoRestart = "auto-restart"
+)
+
 // Locations
 const (
 	LocationGlobal = "/etc/systemd/system"
@@ -47,4 +69,15 @@ const (
 const (
 	EnvService = "SERVICE"
 	EnvEvent   = "EVENT"
+	EnvTime    = "EVENT_TIME"
+	EnvActor   = "ACTOR"
+	EnvOrigin  = "ORIGIN"
+	EnvDetails = "DETAILS"
+)
+
+// Restart policies
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNo        = "no"
 )
@@ -5,24 +5,38 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sukauto/templates"
 	"sync"
+	"time"
 )
 
 type Access interface {
 	Login(username string, password string) (err error)
+	// CertificateUser maps common name of verified client certificate to user
+	CertificateUser(commonName string) (string, error)
+	// PeerUser maps uid of unix socket client to user
+	PeerUser(uid uint32) (string, error)
+	// UserStamp identifies current credentials of user. It is changed with password and fails for removed user
+	UserStamp(username string) (string, error)
+	// LoginFailed reports failed login attempt
+	LoginFailed(username string, origin string, details string)
+	// Role of user for service (empty name means global role)
+	Role(username string, service string) Role
+	// Role of user for group
+	GroupRole(username string, group string) Role
+	TokenManager
 }
 
 type ServiceController interface {
+	// Query statuses of all services and update cache
 	RefreshStatus() AllStatuses
+	// Cached statuses of all services
+	Statuses() AllStatuses
 	Status(name string) ServiceStatus
 	Restart(name string) error
 	Run(name string) error
@@ -44,51 +58,130 @@ type ServiceController interface {
 	Join(groupName string, serviceName string) error
 	Leave(groupName string, serviceName string) error
 	Events() <-chan SystemEvent
+	// As returns controller which marks events by actor (user name or id) and origin (api, telegram, ...)
+	As(actor string, origin string) ServiceController
+	// Definition of service created by sukauto
+	Definition(name string) (NewService, error)
+	// Reinstall regenerates unit of created service from its definition
+	Reinstall(name string) error
+	// Modify definition of created service, re-render its unit and optionally restart it
+	Modify(service NewService, restart bool) (ServiceChange, error)
+	// Remove (uninstall) service: stop, disable, delete unit and forget. Returns location of archive if requested
+	Remove(name string, options RemoveOptions) (string, error)
+	BackupManager
 }
 
 type AccessServiceController interface {
 	ServiceController
 	Access
+	UserManager
+	Reloader
+	// KeepBackups sets number of kept config backups (0 - no backups)
+	KeepBackups(keep int)
 }
 
 type Conf struct {
-	Services   []string            `json:"services,omitempty"`
-	GroupsList map[string][]string `json:"groups,omitempty"`
-	Global     bool                `json:"global"` // as a system-wide services, otherwise - user based
-	Users      map[string]string   `json:"users"`  // no users means no login
-	location   string              `json:"-"`      // config file location
-	event      chan SystemEvent
-	updCmd     string
-	lock       sync.RWMutex
+	Version      int                   `json:"version"` // schema version, see ConfigVersion
+	Services     []string              `json:"services,omitempty"`
+	Definitions  map[string]NewService `json:"definitions,omitempty"` // definitions of services created by sukauto
+	GroupsList   map[string][]string   `json:"groups,omitempty"`
+	Global       bool                  `json:"global"`                 // as a system-wide services, otherwise - user based
+	Users        map[string]string     `json:"users"`                  // no users means no login
+	Roles        map[string]UserRole   `json:"roles,omitempty"`        // no roles means everyone is admin
+	Certificates map[string]string     `json:"certificates,omitempty"` // client certificate CN -> user, CN is a user by default
+	Peers        map[string]string     `json:"peers,omitempty"`        // unix socket client uid -> user, system user name by default
+	Tokens       []Token               `json:"tokens,omitempty"`
+	location     string                `json:"-"` // config file location
+	event        chan SystemEvent
+	updCmd       string
+	executor     Executor
+	backend      Backend
+	cache        statusCache
+	logins       loginCache
+	file         configFile
+	backups      int // number of kept backups
+	lock         sync.RWMutex
 }
 
 func NewServiceControllerByPath(location string, updcmd string) AccessServiceController {
+	return NewServiceControllerWithExecutor(location, updcmd, SystemExecutor{})
+}
+
+// NewServiceControllerWithExecutor creates controller which runs all systemd commands through provided executor
+func NewServiceControllerWithExecutor(location string, updcmd string, executor Executor) AccessServiceController {
+	return newServiceController(location, updcmd, NewSystemctlBackend(executor), executor)
+}
+
+// NewServiceControllerWithBackend creates controller which manages services through provided backend
+func NewServiceControllerWithBackend(location string, updcmd string, backend Backend) AccessServiceController {
+	return newServiceController(location, updcmd, backend, SystemExecutor{})
+}
+
+func newServiceController(location string, updcmd string, backend Backend, executor Executor) AccessServiceController {
 	jFile, err := ioutil.ReadFile(location)
 	if os.IsNotExist(err) {
-		// create default
+		// create default with random password
+		password, err := RandomPassword()
+		if err != nil {
+			panic(err)
+		}
+		hash, err := HashPassword(password)
+		if err != nil {
+			panic(err)
+		}
 		cfg := &Conf{
-			Users:    map[string]string{"root": "root"},
+			Version:  ConfigVersion,
+			Users:    map[string]string{DefaultUser: hash},
 			location: location,
 			updCmd:   updcmd,
+			executor: executor,
+			backend:  backend,
 			event:    make(chan SystemEvent),
+			backups:  DefaultBackups,
 		}
 		err = cfg.save()
 		if err != nil {
 			panic(err)
 		}
+		fmt.Printf("[MONITOR]: Created user %s with password %s\n", DefaultUser, password)
 		return cfg
 	}
 	if err != nil {
 		panic(err)
 	}
+	warnComments(location, jFile)
+	jFile, err = formatOf(location).toJSON(jFile)
+	if err != nil {
+		panic(err)
+	}
 	var data Conf
-	err = json.Unmarshal(jFile, &data)
+	upgraded, err := decodeConfig(jFile, &data)
 	if err != nil {
 		panic(err)
 	}
 	data.location = location
 	data.updCmd = updcmd
+	data.executor = executor
+	data.backend = backend
 	data.event = make(chan SystemEvent)
+	data.backups = DefaultBackups
+	data.file.seen(location)
+	hashed, err := data.hashPasswords()
+	if err != nil {
+		panic(err)
+	}
+	if upgraded || hashed {
+		// previous content is kept as backup. Config with comments which can't be kept is upgraded in memory only
+		if err = data.save(); err != nil && err != ErrTOMLComments {
+			panic(err)
+		}
+	}
+	if upgraded {
+		fmt.Printf("[MONITOR]: Config upgraded to version %d\n", ConfigVersion)
+	}
+	if hashed {
+		fmt.Println("[MONITOR]: Plaintext passwords replaced by hashes")
+	}
 	fmt.Printf("[MONITOR]: Append srv list: %s\n", &data.Services)
 	return &data
 }
@@ -101,12 +194,13 @@ func (cfg *Conf) Events() <-chan SystemEvent {
 	return cfg.event
 }
 
+// Snapshot of groups and cached statuses
 func (cfg *Conf) Snapshot() Snapshot {
+	var ans Snapshot
+	ans.Services = cfg.Statuses().Services
+
 	cfg.lock.RLock()
 	defer cfg.lock.RUnlock()
-
-	var ans Snapshot
-	ans.Services = cfg.RefreshStatus().Services
 	ans.Groups = make([]Group, 0, len(cfg.GroupsList))
 	for name, services := range cfg.GroupsList {
 		ans.Groups = append(ans.Groups, Group{Name: name, Members: services})
@@ -153,7 +247,18 @@ func (cfg *Conf) Members(groupName string) []string {
 	return cfg.GroupsList[groupName]
 }
 
-func (cfg *Conf) Join(groupName string, serviceName string) error {
+// join service to group. Events are emitted out of lock: receiver of events may read config
+func (cfg *Conf) join(groupName string, serviceName string, by Actor) error {
+	joined, err := cfg.addMember(groupName, serviceName)
+	if err != nil || !joined {
+		return err
+	}
+	cfg.emit(by, EventJoined, serviceName, "")
+	return nil
+}
+
+// addMember to group and save config. False means service is already a member
+func (cfg *Conf) addMember(groupName string, serviceName string) (bool, error) {
 	cfg.lock.Lock()
 	defer cfg.lock.Unlock()
 	if cfg.GroupsList == nil {
@@ -161,42 +266,85 @@ func (cfg *Conf) Join(groupName string, serviceName string) error {
 	}
 	for _, item := range cfg.GroupsList[groupName] {
 		if item == serviceName {
-			return nil
+			return false, nil
 		}
 	}
 	if !cfg.isServiceExists(serviceName) {
-		return errors.New("service not exists")
+		return false, errors.New("service not exists")
 	}
 	cfg.GroupsList[groupName] = append(cfg.GroupsList[groupName], serviceName)
-	err := cfg.saveUnsafe()
-	if err != nil {
+	return true, cfg.saveUnsafe()
+}
+
+func (cfg *Conf) leave(groupName string, serviceName string, by Actor) error {
+	left, err := cfg.removeMember(groupName, serviceName)
+	if err != nil || !left {
 		return err
 	}
-	cfg.event <- SystemEvent{Type: EventJoined, Name: serviceName}
+	cfg.emit(by, EventLeaved, serviceName, "")
 	return nil
 }
 
-func (cfg *Conf) Leave(groupName string, serviceName string) error {
+// removeMember from group and save config. False means service is not a member
+func (cfg *Conf) removeMember(groupName string, serviceName string) (bool, error) {
 	cfg.lock.Lock()
 	defer cfg.lock.Unlock()
 	for i, srv := range cfg.GroupsList[groupName] {
 		if srv == serviceName {
 			ar := cfg.GroupsList[groupName]
 			cfg.GroupsList[groupName] = append(ar[:i], ar[i+1:]...)
-			err := cfg.saveUnsafe()
-			if err != nil {
-				return err
-			}
-			cfg.event <- SystemEvent{Type: EventLeaved, Name: serviceName}
-			return nil
+			return true, cfg.saveUnsafe()
 		}
 	}
-	return nil
+	return false, nil
 }
 
 func (cfg *Conf) RefreshStatus() AllStatuses {
-	res := make([]ServiceStatus, 0)
-	for _, srv := range cfg.Services {
+	since := time.Now()
+	all := cfg.queryStatuses()
+	cfg.cache.merge(all.Services, since, cfg.serviceNames())
+	return all
+}
+
+// serviceNames returns copy of services list which is safe to use without lock
+func (cfg *Conf) serviceNames() []string {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	return append([]string(nil), cfg.Services...)
+}
+
+// Statuses returns cached statuses. Services without cached status are queried
+func (cfg *Conf) Statuses() AllStatuses {
+	if cfg.cache.empty() {
+		return cfg.RefreshStatus()
+	}
+	names := cfg.serviceNames()
+	res := make([]ServiceStatus, 0, len(names))
+	for _, name := range names {
+		status, ok := cfg.cache.get(name)
+		if !ok {
+			status = cfg.Status(name)
+		}
+		res = append(res, status)
+	}
+	return AllStatuses{Services: res}
+}
+
+func (cfg *Conf) queryStatuses() AllStatuses {
+	names := cfg.serviceNames()
+	if batch, ok := cfg.backend.(BatchBackend); ok && len(names) > 0 {
+		all, err := batch.PropertiesAll(names, StatusFields, !cfg.Global)
+		if err == nil {
+			res := make([]ServiceStatus, 0, len(names))
+			for _, srv := range names {
+				res = append(res, newServiceStatus(srv, all[srv]))
+			}
+			return AllStatuses{Services: res}
+		}
+		fmt.Println("[ERROR]: Batch status:", err)
+	}
+	res := make([]ServiceStatus, 0, len(names))
+	for _, srv := range names {
 		result := cfg.Status(srv)
 		res = append(res, result)
 	}
@@ -204,74 +352,100 @@ func (cfg *Conf) RefreshStatus() AllStatuses {
 }
 
 func (cfg *Conf) Status(name string) ServiceStatus {
-	result, err := controlQueryField(name, FieldStatus, !cfg.Global)
+	result, err := cfg.backend.Properties(name, StatusFields, !cfg.Global)
 	if err != nil {
 		fmt.Printf("[ERROR]: Status for srv: %s", name)
 		return ServiceStatus{Status: StateUnknown, Name: name}
 	}
-	return ServiceStatus{Status: result, Name: name}
+	status := newServiceStatus(name, result)
+	cfg.cache.put(status)
+	return status
 }
 
-func (cfg *Conf) Restart(name string) error {
-	_, err := control(name, RESTART, !cfg.Global)
+func (cfg *Conf) restart(name string, by Actor) error {
+	err := cfg.backend.Control(name, RESTART, !cfg.Global)
 	if err != nil {
 		fmt.Printf("[ERROR]: Restart srv: %s", name)
 		return err
 	} else {
-		cfg.event <- SystemEvent{Type: EventRestarted, Name: name}
+		cfg.Status(name) // actualize cache
+		cfg.emit(by, EventRestarted, name, "")
 	}
 	return nil
 }
 
-func (cfg *Conf) Run(name string) error {
-	_, err := control(name, RUN, !cfg.Global)
+func (cfg *Conf) run(name string, by Actor) error {
+	err := cfg.backend.Control(name, RUN, !cfg.Global)
 	if err != nil {
 		fmt.Printf("[ERROR]: Run srv: %s", name)
 		return err
 	} else {
-		cfg.event <- SystemEvent{Type: EventStarted, Name: name}
+		cfg.Status(name) // actualize cache
+		cfg.emit(by, EventStarted, name, "")
 	}
 	return nil
 }
 
-func (cfg *Conf) Stop(name string) error {
-	_, err := control(name, STOP, !cfg.Global)
+func (cfg *Conf) stop(name string, by Actor) error {
+	err := cfg.backend.Control(name, STOP, !cfg.Global)
 	if err != nil {
 		fmt.Printf("[ERROR]: Run srv: %s", name)
 		return err
 	} else {
-		cfg.event <- SystemEvent{Type: EventStopped, Name: name}
+		cfg.Status(name) // actualize cache
+		cfg.emit(by, EventStopped, name, "")
 	}
 	return nil
 }
 
-func (cfg *Conf) Update(name string) error {
+func (cfg *Conf) update(name string, by Actor) error {
 	var err error
+	if upd, ok := cfg.backend.(Updater); ok {
+		err = upd.Update(name, !cfg.Global)
+		if err != nil {
+			fmt.Printf("[ERROR]: Update srv: %s", name)
+			return err
+		}
+		cfg.emit(by, EventUpdated, name, "")
+		return nil
+	}
 	preUpdInfo := cfg.Status(name)
 
-	err = cfg.Stop(name)
+	err = cfg.stop(name, by)
 	if err != nil {
 		fmt.Printf("[ERROR]: Stop srv on upd: %s", name)
 		return err
 	}
 
-	_, err = updater(name, cfg.updCmd, !cfg.Global)
+	_, err = updater(cfg.backend, cfg.executor, name, cfg.updCmd, !cfg.Global)
 	if err != nil {
 		fmt.Printf("[ERROR]: Update srv: %s", name)
 		return err
 	}
 
 	if preUpdInfo.Status == "running" {
-		err = cfg.Run(name)
+		err = cfg.run(name, by)
 		if err != nil {
 			fmt.Printf("[ERROR]: Start srv on upd: %s", name)
 			return err
 		}
 	}
-	cfg.event <- SystemEvent{Type: EventUpdated, Name: name}
+	cfg.emit(by, EventUpdated, name, "")
 	return nil
 }
 
+// emit event on behalf of actor
+func (cfg *Conf) emit(by Actor, tp Event, name string, details string) {
+	cfg.event <- SystemEvent{
+		Type:    tp,
+		Name:    name,
+		Time:    time.Now(),
+		Actor:   by.Name,
+		Origin:  by.Origin,
+		Details: details,
+	}
+}
+
 func (cfg *Conf) isServiceExists(name string) bool {
 	for _, srv := range cfg.Services {
 		if srv == name {
@@ -281,126 +455,140 @@ func (cfg *Conf) isServiceExists(name string) bool {
 	return false
 }
 
-func updater(name string, updcmd string, user bool) (string, error) {
-	stdout := &bytes.Buffer{}
-	srvWorkDir, _ := controlQueryField(name, WORKDIR, user)
+func updater(backend Backend, executor Executor, name string, updcmd string, user bool) (string, error) {
+	return executor.Execute(workingDirectory(backend, name, user), SHELL, "-c", updcmd)
+}
+
+// workingDirectory of service reported by backend
+func workingDirectory(backend Backend, name string, user bool) string {
+	props, _ := backend.Properties(name, []string{WORKDIR}, user)
 	// remove 'WorkingDirectory=' from string
-	srvWorkDir = strings.TrimSpace(srvWorkDir)
+	srvWorkDir := strings.TrimSpace(props[WORKDIR])
 	if len(srvWorkDir) > 0 && srvWorkDir[0] == '!' {
 		srvWorkDir = srvWorkDir[1:]
 	}
-
-	cmd := exec.Command(SHELL, "-c", updcmd)
-	cmd.Stdout = io.Writer(stdout)
-	cmd.Stderr = os.Stderr
-	cmd.Dir = srvWorkDir
-	err := cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	res := stdout.String()
-	return res, nil
-
+	return srvWorkDir
 }
 
-func (cfg *Conf) Create(service NewService) error {
-	cfg.lock.Lock()
-	defer cfg.lock.Unlock()
+func (cfg *Conf) create(service NewService, by Actor) error {
 	// resolve working directory
 	workingDir, err := filepath.Abs(service.WorkingDirectory)
 	if err != nil {
 		return err
 	}
 	service.WorkingDirectory = workingDir
-	// generate unit file
-	data := &bytes.Buffer{}
-	err = templates.ServiceUnitTemplate.Execute(data, service)
+	err = cfg.install(service)
 	if err != nil {
 		return err
 	}
-	// detect location for unit file
-	var location = LocationGlobal
-	if !cfg.Global {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return err
-		}
-		location = filepath.Join(home, LocationUser)
+	// install (enable)
+	err = cfg.enable(service.Name, by)
+	if err != nil {
+		return err
 	}
-	// ensure that target directory exists
-	err = os.MkdirAll(location, 0755)
+	// save to config with definition to regenerate unit later
+	cfg.lock.Lock()
+	cfg.Services = append(cfg.Services, service.Name)
+	if cfg.Definitions == nil {
+		cfg.Definitions = make(map[string]NewService)
+	}
+	cfg.Definitions[service.Name] = service.clone()
+	err = cfg.saveUnsafe()
+	cfg.lock.Unlock()
 	if err != nil {
 		return err
 	}
-	unitFile := filepath.Join(location, service.Name+".service")
-	// save unit file
-	err = ioutil.WriteFile(unitFile, data.Bytes(), 0755)
+	cfg.emit(by, EventCreated, service.Name, "")
+	return nil
+}
+
+// writeUnit generates systemd unit file for service
+func writeUnit(service NewService, user bool) error {
+	data, err := renderUnit(service)
 	if err != nil {
 		return err
 	}
-	// install (enable)
-	err = cfg.Enable(service.Name)
+	unitFile, err := unitLocation(service.Name, user)
 	if err != nil {
 		return err
 	}
-	// save to config
-	// TODO: maybe save full information
-	cfg.Services = append(cfg.Services, service.Name)
-	err = cfg.saveUnsafe()
+	// ensure that target directory exists
+	err = os.MkdirAll(filepath.Dir(unitFile), 0755)
 	if err != nil {
 		return err
 	}
-	cfg.event <- SystemEvent{Type: EventCreated, Name: service.Name}
-	return nil
+	// save unit file
+	return writeFileAtomic(unitFile, data, 0755)
+}
+
+// renderUnit generates content of systemd unit file for service
+func renderUnit(service NewService) ([]byte, error) {
+	data := &bytes.Buffer{}
+	err := templates.ServiceUnitTemplate.Execute(data, service)
+	return data.Bytes(), err
+}
+
+// unitLocation is a path of unit file for service
+func unitLocation(name string, user bool) (string, error) {
+	var location = LocationGlobal
+	if user {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		location = filepath.Join(home, LocationUser)
+	}
+	return filepath.Join(location, name+".service"), nil
 }
 
-func (cfg *Conf) Attach(name string) error {
+func (cfg *Conf) attach(name string, by Actor) error {
 	cfg.lock.Lock()
-	defer cfg.lock.Unlock()
 	cfg.Services = append(cfg.Services, name)
 	err := cfg.saveUnsafe()
+	cfg.lock.Unlock()
 	if err != nil {
 		return err
 	}
-	cfg.event <- SystemEvent{Type: EventCreated, Name: name}
+	cfg.Status(name) // actualize cache
+	cfg.emit(by, EventCreated, name, "")
 	return nil
 }
 
-func (cfg *Conf) Enable(name string) error {
-	_, err := control(name, CmdEnable, !cfg.Global)
+func (cfg *Conf) enable(name string, by Actor) error {
+	err := cfg.backend.Control(name, CmdEnable, !cfg.Global)
 	if err == nil {
-		cfg.event <- SystemEvent{Type: EventEnabled, Name: name}
+		cfg.Status(name) // actualize cache
+		cfg.emit(by, EventEnabled, name, "")
 	}
 	return err
 }
 
-func (cfg *Conf) Disable(name string) error {
-	_, err := control(name, CmdDisable, !cfg.Global)
+func (cfg *Conf) disable(name string, by Actor) error {
+	err := cfg.backend.Control(name, CmdDisable, !cfg.Global)
 	if err == nil {
-		cfg.event <- SystemEvent{Type: EventDisabled, Name: name}
+		cfg.Status(name) // actualize cache
+		cfg.emit(by, EventDisabled, name, "")
 	}
 	return err
 }
 
-func (cfg *Conf) Login(username string, password string) (err error) {
-	if len(cfg.Users) == 0 {
-		return nil
-	}
-	expected, ok := cfg.Users[username]
-	if !ok || expected != password {
-		return errors.New("invalid user or password")
-	}
-	return nil
-}
-
 func (cfg *Conf) Log(name string) (string, error) {
-	return journal(name, !cfg.Global)
+	return cfg.backend.Log(name, !cfg.Global)
 }
 
-func (cfg *Conf) Forget(name string) error {
+func (cfg *Conf) forget(name string, by Actor) error {
 	cfg.lock.Lock()
-	defer cfg.lock.Unlock()
+	err := cfg.dropUnsafe(name)
+	cfg.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	cfg.emit(by, EventRemoved, name, "")
+	return nil
+}
+
+// dropUnsafe removes service from config, groups and cache
+func (cfg *Conf) dropUnsafe(name string) error {
 	for i, srv := range cfg.Services {
 		if srv == name {
 			cfg.Services = append(cfg.Services[:i], cfg.Services[i+1:]...)
@@ -416,11 +604,12 @@ func (cfg *Conf) Forget(name string) error {
 			}
 		}
 	}
+	delete(cfg.Definitions, name)
 	err := cfg.saveUnsafe()
 	if err != nil {
 		return err
 	}
-	cfg.event <- SystemEvent{Type: EventRemoved, Name: name}
+	cfg.cache.remove(name)
 	return nil
 }
 
@@ -435,64 +624,11 @@ func (cfg *Conf) saveUnsafe() error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(cfg.location, data, 0755)
-}
-
-func control(name string, operation string, user bool) (string, error) {
-	stdout := &bytes.Buffer{}
-	var args []string
-	if user {
-		args = append(args, ModeUser)
-	}
-	args = append(args, operation, name)
-	cmd := exec.Command(COMMAND, args...)
-	cmd.Stdout = io.Writer(stdout)
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+	// previous content is a source of comments
+	previous, _ := ioutil.ReadFile(cfg.location)
+	data, err = formatOf(cfg.location).fromJSON(data, previous)
 	if err != nil {
-		return "", err
-	}
-	res := stdout.String()
-
-	return res, nil
-}
-
-func journal(name string, user bool) (string, error) {
-	stdout := &bytes.Buffer{}
-	var args = []string{ModeMergeJournals, ModeNoPages, ModeQuite, ModeLimit, strconv.Itoa(LogLimit)}
-	if user {
-		args = append(args, ModeUserUnit)
-	} else {
-		args = append(args, ModeSystemUnit)
-	}
-	args = append(args, name)
-	cmd := exec.Command(JournalCommand, args...)
-	cmd.Stdout = io.Writer(stdout)
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return "", err
-	}
-	res := strings.TrimSpace(stdout.String())
-
-	return res, nil
-}
-
-func controlQueryField(name string, field string, user bool) (string, error) {
-	stdout := &bytes.Buffer{}
-	var args []string
-	if user {
-		args = append(args, ModeUser)
-	}
-	args = append(args, CmdShow, "-p", field, "--value", name)
-	cmd := exec.Command(COMMAND, args...)
-	cmd.Stdout = io.Writer(stdout)
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return "", err
+		return err
 	}
-	res := strings.TrimSpace(stdout.String())
-
-	return res, nil
+	return cfg.writeUnsafe(data)
 }
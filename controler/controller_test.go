@@ -1,26 +1,143 @@
 package controler
 
 import (
-	"fmt"
+	"errors"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const testData = "test-data"
 
-func TestConf_Create(t *testing.T) {
+// fakeSystemd emulates systemctl and journalctl for tests
+type fakeSystemd struct {
+	lock    sync.Mutex
+	running map[string]bool
+	enabled map[string]bool
+	fail    map[string]bool // operations which fail
+	calls   []string
+}
+
+func newFakeSystemd() *fakeSystemd {
+	return &fakeSystemd{running: make(map[string]bool), enabled: make(map[string]bool), fail: make(map[string]bool)}
+}
+
+func (fs *fakeSystemd) Execute(dir string, command string, args ...string) (string, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.calls = append(fs.calls, strings.TrimSpace(command+" "+strings.Join(args, " ")))
+	if len(args) > 0 && args[0] == ModeUser {
+		args = args[1:]
+	}
+	switch command {
+	case JournalCommand:
+		name := args[len(args)-1]
+		return "-- Logs begin --\n" + name + " log line\n", nil
+	case SHELL:
+		return "updated in " + dir, nil
+	case COMMAND:
+	default:
+		return "", errors.New("unknown command " + command)
+	}
+	if len(args) > 0 && fs.fail[args[0]] {
+		return "", errors.New(args[0] + " failed")
+	}
+	if len(args) == 1 && args[0] == CmdReload {
+		return "", nil
+	}
+	if len(args) < 2 {
+		return "", errors.New("not enough arguments")
+	}
+	if args[0] == CmdShow {
+		var blocks []string
+		for _, name := range args[3:] {
+			blocks = append(blocks, fs.show(name, strings.Split(args[2], ",")))
+		}
+		return strings.Join(blocks, "\n"), nil
+	}
+	name := args[len(args)-1]
+	switch args[0] {
+	case RUN, RESTART:
+		fs.running[name] = true
+	case STOP:
+		fs.running[name] = false
+	case CmdEnable:
+		fs.enabled[name] = true
+	case CmdDisable:
+		fs.enabled[name] = false
+	default:
+		return "", errors.New("unknown operation " + args[0])
+	}
+	return "", nil
+}
+
+func (fs *fakeSystemd) show(name string, fields []string) string {
+	var out []string
+	for _, field := range fields {
+		value := ""
+		switch field {
+		case FieldStatus:
+			value = "dead"
+			if fs.running[name] {
+				value = "running"
+			}
+		case WORKDIR:
+			value = "!/srv/" + name
+		case FieldUnitFileState:
+			value = "disabled"
+			if fs.enabled[name] {
+				value = "enabled"
+			}
+		}
+		out = append(out, field+"="+value)
+	}
+	return strings.Join(out, "\n") + "\n"
+}
 
-	controller := NewServiceControllerByPath(testData + "/config.json")
+func newTestController(t *testing.T) (AccessServiceController, *fakeSystemd, <-chan SystemEvent) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	// user units are created in $HOME
+	t.Setenv("HOME", dir)
+	fake := newFakeSystemd()
+	controller := NewServiceControllerWithExecutor(filepath.Join(dir, "config.json"), "git pull origin master", fake)
+	events := make(chan SystemEvent, 128)
+	go func() {
+		for event := range controller.Events() {
+			events <- event
+		}
+	}()
+	return controller, fake, events
+}
+
+func TestConf_Create(t *testing.T) {
+	controller, fake, _ := newTestController(t)
 	err := controller.Create(NewService{
 		Name:             "test-gm",
-		Command:          resolveBin("nc") + " -v -l 9000",
+		Command:          "/usr/bin/nc -v -l 9000",
 		WorkingDirectory: testData,
 	})
 	if err != nil {
 		t.Error("create service", err)
 		return
 	}
+	home, _ := os.UserHomeDir()
+	if _, err := os.Stat(filepath.Join(home, LocationUser, "test-gm.service")); err != nil {
+		t.Error("unit file not created:", err)
+		return
+	}
+	if !fake.enabled["test-gm"] {
+		t.Error("service not enabled")
+		return
+	}
 	status := controller.Status("test-gm")
 	if status.Status != "dead" {
 		t.Error("mismatch status:", status.Status)
@@ -48,7 +165,6 @@ func TestConf_Create(t *testing.T) {
 		t.Error("empty log")
 		return
 	}
-	fmt.Println(log)
 
 	err = controller.Stop("test-gm")
 	if err != nil {
@@ -67,17 +183,198 @@ func TestConf_Create(t *testing.T) {
 		t.Error("disable service", err)
 		return
 	}
+	if fake.enabled["test-gm"] {
+		t.Error("service still enabled")
+		return
+	}
+}
+
+func TestConf_Update(t *testing.T) {
+	controller, fake, _ := newTestController(t)
+	if err := controller.Attach("test-gm"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Run("test-gm"); err != nil {
+		t.Fatal(err)
+	}
+	fake.calls = nil
+	if err := controller.Update("test-gm"); err != nil {
+		t.Fatal(err)
+	}
+	status := COMMAND + " --user show -p " + strings.Join(StatusFields, ",") + " test-gm"
+	expected := []string{
+		status,
+		COMMAND + " --user stop test-gm",
+		status,
+		COMMAND + " --user show -p WorkingDirectory test-gm",
+		SHELL + " -c git pull origin master",
+		COMMAND + " --user start test-gm",
+		status,
+	}
+	if strings.Join(fake.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected calls:\n%s", strings.Join(fake.calls, "\n"))
+	}
+}
+
+func TestConf_RefreshStatus(t *testing.T) {
+	controller, fake, _ := newTestController(t)
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		if err := controller.Attach(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := controller.Run("beta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Enable("gamma"); err != nil {
+		t.Fatal(err)
+	}
+	fake.calls = nil
+	statuses := controller.RefreshStatus().Services
+	if len(fake.calls) != 1 {
+		t.Error("expected single call, got:", fake.calls)
+	}
+	if len(statuses) != 3 {
+		t.Fatal("unexpected statuses:", statuses)
+	}
+	for i, expected := range []ServiceStatus{
+		{Name: "alpha", Status: "dead", UnitFileState: "disabled"},
+		{Name: "beta", Status: "running", UnitFileState: "disabled"},
+		{Name: "gamma", Status: "dead", UnitFileState: "enabled"},
+	} {
+		if statuses[i] != expected {
+			t.Error("unexpected status:", statuses[i], "expected", expected)
+		}
+	}
+}
+
+func TestConf_Snapshot(t *testing.T) {
+	controller, fake, _ := newTestController(t)
+	if err := controller.Attach("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	controller.RefreshStatus()
+	// status changed outside, but cache is fed by actions only
+	fake.running["alpha"] = true
+	fake.calls = nil
+	snapshot := controller.Snapshot()
+	if len(fake.calls) != 0 {
+		t.Error("snapshot should not query systemd:", fake.calls)
+	}
+	if len(snapshot.Services) != 1 || snapshot.Services[0].Status != "dead" {
+		t.Error("unexpected cached statuses:", snapshot.Services)
+	}
+	if err := controller.Stop("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Run("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if status := controller.Statuses().Services[0]; status.Status != "running" {
+		t.Error("cache not updated by action:", status)
+	}
+	if err := controller.Forget("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if statuses := controller.Statuses().Services; len(statuses) != 0 {
+		t.Error("forgotten service still cached:", statuses)
+	}
+}
+
+func TestStatusCache_Merge(t *testing.T) {
+	var cache statusCache
+	since := time.Now()
+	cache.put(ServiceStatus{Name: "alpha", Status: StateRunning})
+	cache.put(ServiceStatus{Name: "gamma", Status: StateRunning})
+	// slow sweep started before action and before gamma was removed
+	cache.merge([]ServiceStatus{
+		{Name: "alpha", Status: StateDead},
+		{Name: "beta", Status: StateDead},
+		{Name: "gamma", Status: StateDead},
+	}, since, []string{"alpha", "beta"})
+	if status, _ := cache.get("alpha"); status.Status != StateRunning {
+		t.Error("fresher status is overwritten:", status)
+	}
+	if status, ok := cache.get("beta"); !ok || status.Status != StateDead {
+		t.Error("status is not merged:", status)
+	}
+	if _, ok := cache.get("gamma"); ok {
+		t.Error("removed service is cached")
+	}
+	cache.merge([]ServiceStatus{{Name: "alpha", Status: StateDead}}, time.Now(), []string{"alpha"})
+	if status, _ := cache.get("alpha"); status.Status != StateDead {
+		t.Error("newer sweep is not merged:", status)
+	}
 }
 
-func resolveBin(bin string) string {
-	cmd, err := exec.LookPath(bin)
+func TestConf_MutationsWithBackgroundCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	t.Setenv("HOME", dir)
+	controller := NewServiceControllerWithExecutor(filepath.Join(dir, "config.json"), "", newFakeSystemd())
+	// background check drains events of controller and reads config itself
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for range WithBackgroundCheck(controller.Events(), time.Millisecond, controller) {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- func() error {
+			if err := controller.Group("backend"); err != nil {
+				return err
+			}
+			for i := 0; i < 20; i++ {
+				name := "app" + strconv.Itoa(i)
+				if err := controller.Create(NewService{Name: name, Command: "/bin/app", WorkingDirectory: testData}); err != nil {
+					return err
+				}
+				if err := controller.Attach("attached" + strconv.Itoa(i)); err != nil {
+					return err
+				}
+				if err := controller.Join("backend", name); err != nil {
+					return err
+				}
+				if err := controller.Leave("backend", name); err != nil {
+					return err
+				}
+			}
+			return nil
+		}()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("mutations are deadlocked with background check")
 	}
-	return cmd
 }
 
-func init() {
-	os.RemoveAll(testData)
-	os.MkdirAll(testData, 0755)
+func TestConf_As(t *testing.T) {
+	controller, _, events := newTestController(t)
+	if err := controller.Attach("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if event := <-events; event.Type != EventCreated || event.Actor != "" || event.Time.IsZero() {
+		t.Error("unexpected event:", event)
+	}
+	if err := controller.As("alice", OriginAPI).Run("alpha"); err != nil {
+		t.Fatal(err)
+	}
+	event := <-events
+	if event.Type != EventStarted || event.Name != "alpha" || event.Actor != "alice" || event.Origin != OriginAPI {
+		t.Error("unexpected event:", event)
+	}
 }
@@ -0,0 +1,296 @@
+package controler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// systemd D-Bus API
+const (
+	SystemdDestination   = "org.freedesktop.systemd1"
+	SystemdPath          = dbus.ObjectPath("/org/freedesktop/systemd1")
+	SystemdManager       = "org.freedesktop.systemd1.Manager"
+	SystemdUnit          = "org.freedesktop.systemd1.Unit"
+	SystemdService       = "org.freedesktop.systemd1.Service"
+	DBusPropertiesGetAll = "org.freedesktop.DBus.Properties.GetAll"
+	SignalJobRemoved     = "JobRemoved"
+	JobModeReplace       = "replace"
+	JobResultDone        = "done"
+	JobTimeout           = 2 * time.Minute
+	ServiceUnitSuffix    = ".service"
+)
+
+// DBusBackend talks to systemd over D-Bus instead of forking systemctl. System-wide services are managed
+// through system bus, user services - through session bus. Journal has no D-Bus API, so logs are still read
+// by journalctl through executor
+type DBusBackend struct {
+	executor Executor
+	lock     sync.Mutex
+	system   *dbus.Conn
+	session  *dbus.Conn
+	jobs     map[*dbus.Conn]*jobWatcher
+}
+
+// NewDBusBackend creates backend which lazily connects to system and session buses
+func NewDBusBackend(executor Executor) *DBusBackend {
+	return NewDBusBackendWithConn(nil, nil, executor)
+}
+
+// NewDBusBackendWithConn creates backend over already established connections. Nil connection will be
+// opened on demand
+func NewDBusBackendWithConn(system, session *dbus.Conn, executor Executor) *DBusBackend {
+	return &DBusBackend{
+		executor: executor,
+		system:   system,
+		session:  session,
+		jobs:     make(map[*dbus.Conn]*jobWatcher),
+	}
+}
+
+func (db *DBusBackend) Control(name string, operation string, user bool) error {
+	conn, err := db.conn(user)
+	if err != nil {
+		return err
+	}
+	manager := conn.Object(SystemdDestination, SystemdPath)
+	unit := unitName(name)
+	switch operation {
+	case RUN:
+		return db.job(conn, "StartUnit", unit, JobModeReplace)
+	case STOP:
+		return db.job(conn, "StopUnit", unit, JobModeReplace)
+	case RESTART:
+		return db.job(conn, "RestartUnit", unit, JobModeReplace)
+	case CmdEnable:
+		err = manager.Call(SystemdManager+".EnableUnitFiles", 0, []string{unit}, false, true).Err
+	case CmdDisable:
+		err = manager.Call(SystemdManager+".DisableUnitFiles", 0, []string{unit}, false).Err
+	default:
+		return errors.New("unsupported operation " + operation)
+	}
+	if err != nil {
+		return err
+	}
+	// the same as systemctl does after changes in unit files
+	return manager.Call(SystemdManager+".Reload", 0).Err
+}
+
+func (db *DBusBackend) Properties(name string, fields []string, user bool) (map[string]string, error) {
+	conn, err := db.conn(user)
+	if err != nil {
+		return nil, err
+	}
+	var unitPath dbus.ObjectPath
+	err = conn.Object(SystemdDestination, SystemdPath).Call(SystemdManager+".LoadUnit", 0, unitName(name)).Store(&unitPath)
+	if err != nil {
+		return nil, err
+	}
+	unit := conn.Object(SystemdDestination, unitPath)
+	all := make(map[string]dbus.Variant)
+	for _, iface := range []string{SystemdUnit, SystemdService} {
+		var props map[string]dbus.Variant
+		err = unit.Call(DBusPropertiesGetAll, 0, iface).Store(&props)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range props {
+			all[k] = v
+		}
+	}
+	ans := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if v, ok := all[field]; ok {
+			ans[field] = formatVariant(v)
+		} else {
+			ans[field] = ""
+		}
+	}
+	return ans, nil
+}
+
+func (db *DBusBackend) DaemonReload(user bool) error {
+	conn, err := db.conn(user)
+	if err != nil {
+		return err
+	}
+	return conn.Object(SystemdDestination, SystemdPath).Call(SystemdManager+".Reload", 0).Err
+}
+
+func (db *DBusBackend) Log(name string, user bool) (string, error) {
+	return journal(db.executor, name, user)
+}
+
+func (db *DBusBackend) conn(user bool) (*dbus.Conn, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var err error
+	if user {
+		if db.session == nil {
+			db.session, err = dbus.SessionBus()
+		}
+		return db.session, err
+	}
+	if db.system == nil {
+		db.system, err = dbus.SystemBus()
+	}
+	return db.system, err
+}
+
+// job calls manager method which enqueues systemd job and waits for the job completion like systemctl does
+func (db *DBusBackend) job(conn *dbus.Conn, method string, args ...interface{}) error {
+	watcher, err := db.watcher(conn)
+	if err != nil {
+		return err
+	}
+	// listen before call to not miss fast jobs
+	watcher.listen()
+	var job dbus.ObjectPath
+	defer func() { watcher.forget(job) }()
+	err = conn.Object(SystemdDestination, SystemdPath).Call(SystemdManager+"."+method, 0, args...).Store(&job)
+	if err != nil {
+		return err
+	}
+	timeout := time.NewTimer(JobTimeout)
+	defer timeout.Stop()
+	select {
+	case result := <-watcher.wait(job):
+		if result != JobResultDone {
+			return fmt.Errorf("job %s for %v failed: %s", method, args[0], result)
+		}
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("job %s for %v timed out", method, args[0])
+	}
+}
+
+func (db *DBusBackend) watcher(conn *dbus.Conn) (*jobWatcher, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if w, ok := db.jobs[conn]; ok {
+		return w, nil
+	}
+	w, err := newJobWatcher(conn)
+	if err != nil {
+		return nil, err
+	}
+	db.jobs[conn] = w
+	return w, nil
+}
+
+// jobWatcher dispatches JobRemoved signals of one connection to waiting callers. Signals are drained
+// continuously: results of jobs are kept until caller, which does not know job path before reply, picks them up
+type jobWatcher struct {
+	lock    sync.Mutex
+	pending int                             // callers which started jobs
+	results map[dbus.ObjectPath]string      // finished jobs nobody waits for yet
+	waiting map[dbus.ObjectPath]chan string // callers waiting for jobs
+}
+
+func newJobWatcher(conn *dbus.Conn) (*jobWatcher, error) {
+	err := conn.AddMatchSignal(dbus.WithMatchInterface(SystemdManager), dbus.WithMatchMember(SignalJobRemoved))
+	if err != nil {
+		return nil, err
+	}
+	// systemd emits signals only for subscribed clients
+	err = conn.Object(SystemdDestination, SystemdPath).Call(SystemdManager+".Subscribe", 0).Err
+	if err != nil {
+		return nil, err
+	}
+	w := &jobWatcher{results: make(map[dbus.ObjectPath]string), waiting: make(map[dbus.ObjectPath]chan string)}
+	signals := make(chan *dbus.Signal, 64)
+	conn.Signal(signals)
+	go w.dispatch(signals)
+	return w, nil
+}
+
+func (w *jobWatcher) dispatch(signals <-chan *dbus.Signal) {
+	for signal := range signals {
+		// JobRemoved(u id, o job, s unit, s result)
+		if signal.Name != SystemdManager+"."+SignalJobRemoved || len(signal.Body) != 4 {
+			continue
+		}
+		job, _ := signal.Body[1].(dbus.ObjectPath)
+		result, _ := signal.Body[3].(string)
+		w.lock.Lock()
+		if ch, ok := w.waiting[job]; ok {
+			ch <- result
+			delete(w.waiting, job)
+		} else if w.pending > 0 {
+			w.results[job] = result
+		}
+		w.lock.Unlock()
+	}
+}
+
+// listen starts collecting results before job is enqueued
+func (w *jobWatcher) listen() {
+	w.lock.Lock()
+	w.pending++
+	w.lock.Unlock()
+}
+
+// wait returns channel which receives result of the job
+func (w *jobWatcher) wait(job dbus.ObjectPath) <-chan string {
+	ch := make(chan string, 1)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if result, ok := w.results[job]; ok {
+		ch <- result
+		delete(w.results, job)
+	} else {
+		w.waiting[job] = ch
+	}
+	return ch
+}
+
+// forget the job; results of foreign jobs are dropped when nobody listens
+func (w *jobWatcher) forget(job dbus.ObjectPath) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.pending--
+	delete(w.waiting, job)
+	delete(w.results, job)
+	if w.pending == 0 {
+		w.results = make(map[dbus.ObjectPath]string)
+	}
+}
+
+// unitName adds .service suffix like systemctl does for names without unit type
+func unitName(name string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	return name + ServiceUnitSuffix
+}
+
+// formatVariant converts D-Bus value to the same text representation as systemctl show
+func formatVariant(v dbus.Variant) string {
+	switch value := v.Value().(type) {
+	case string:
+		return value
+	case dbus.ObjectPath:
+		return string(value)
+	case bool:
+		if value {
+			return "yes"
+		}
+		return "no"
+	case int32:
+		return strconv.FormatInt(int64(value), 10)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint32:
+		return strconv.FormatUint(uint64(value), 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case []string:
+		return strings.Join(value, " ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,253 @@
+package controler
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeManager emulates org.freedesktop.systemd1 on a private session bus
+type fakeManager struct {
+	conn    *dbus.Conn
+	lock    sync.Mutex
+	jobID   uint32
+	running map[string]bool
+	enabled map[string]bool
+	reloads int
+	noise   int // jobs of other clients finished before each job
+}
+
+func (fm *fakeManager) Subscribe() *dbus.Error { return nil }
+
+func (fm *fakeManager) Reload() *dbus.Error {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	fm.reloads++
+	return nil
+}
+
+func (fm *fakeManager) StartUnit(name, mode string) (dbus.ObjectPath, *dbus.Error) {
+	return fm.job(name, true)
+}
+
+func (fm *fakeManager) StopUnit(name, mode string) (dbus.ObjectPath, *dbus.Error) {
+	return fm.job(name, false)
+}
+
+func (fm *fakeManager) RestartUnit(name, mode string) (dbus.ObjectPath, *dbus.Error) {
+	return fm.job(name, true)
+}
+
+func (fm *fakeManager) EnableUnitFiles(files []string, runtime, force bool) (bool, []struct{ A, B, C string }, *dbus.Error) {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	for _, f := range files {
+		fm.enabled[f] = true
+	}
+	return true, nil, nil
+}
+
+func (fm *fakeManager) DisableUnitFiles(files []string, runtime bool) ([]struct{ A, B, C string }, *dbus.Error) {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	for _, f := range files {
+		fm.enabled[f] = false
+	}
+	return nil, nil
+}
+
+func (fm *fakeManager) LoadUnit(name string) (dbus.ObjectPath, *dbus.Error) {
+	path := dbus.ObjectPath("/org/freedesktop/systemd1/unit/" + escapePath(name))
+	err := fm.conn.Export(&fakeUnit{manager: fm, name: name}, path, "org.freedesktop.DBus.Properties")
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return path, nil
+}
+
+func (fm *fakeManager) isEnabled(unit string) (bool, int) {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	return fm.enabled[unit], fm.reloads
+}
+
+func (fm *fakeManager) job(name string, running bool) (dbus.ObjectPath, *dbus.Error) {
+	fm.lock.Lock()
+	fm.jobID++
+	id := fm.jobID
+	fm.running[name] = running
+	noise := fm.noise
+	fm.jobID += uint32(noise)
+	fm.lock.Unlock()
+	path := dbus.ObjectPath("/org/freedesktop/systemd1/job/" + strconv.Itoa(int(id)))
+	if noise == 0 {
+		go fm.conn.Emit(SystemdPath, SystemdManager+"."+SignalJobRemoved, id, path, name, JobResultDone)
+		return path, nil
+	}
+	// all signals are sent before reply, so client can not consume them until it knows own job
+	for i := 1; i <= noise; i++ {
+		other := dbus.ObjectPath("/org/freedesktop/systemd1/job/" + strconv.Itoa(int(id)+i))
+		fm.conn.Emit(SystemdPath, SystemdManager+"."+SignalJobRemoved, id+uint32(i), other, "other.service", JobResultDone)
+	}
+	fm.conn.Emit(SystemdPath, SystemdManager+"."+SignalJobRemoved, id, path, name, JobResultDone)
+	return path, nil
+}
+
+// escapePath escapes unit name for object path like systemd does
+func escapePath(name string) string {
+	var sb strings.Builder
+	for _, c := range []byte(name) {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "_%02x", c)
+		}
+	}
+	return sb.String()
+}
+
+type fakeUnit struct {
+	manager *fakeManager
+	name    string
+}
+
+func (fu *fakeUnit) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	fu.manager.lock.Lock()
+	defer fu.manager.lock.Unlock()
+	switch iface {
+	case SystemdUnit:
+		state := "dead"
+		if fu.manager.running[fu.name] {
+			state = "running"
+		}
+		return map[string]dbus.Variant{"SubState": dbus.MakeVariant(state)}, nil
+	case SystemdService:
+		return map[string]dbus.Variant{"WorkingDirectory": dbus.MakeVariant("/srv/" + fu.name)}, nil
+	}
+	return map[string]dbus.Variant{}, nil
+}
+
+// startSessionBus launches private dbus-daemon and returns its address
+func startSessionBus(t *testing.T) string {
+	bin, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command(bin, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skip("failed start dbus-daemon:", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// startFakeManager exports fake systemd manager on private bus and returns backend connected to it
+func startFakeManager(t *testing.T) (*fakeManager, *DBusBackend) {
+	address := startSessionBus(t)
+	server, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	manager := &fakeManager{conn: server, running: make(map[string]bool), enabled: make(map[string]bool)}
+	if err := server.Export(manager, SystemdPath, SystemdManager); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := server.RequestName(SystemdDestination, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatal("request name:", reply, err)
+	}
+
+	client, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return manager, NewDBusBackendWithConn(nil, client, newFakeSystemd())
+}
+
+func TestDBusBackend(t *testing.T) {
+	manager, backend := startFakeManager(t)
+
+	if err := backend.Control("test-gm", CmdEnable, true); err != nil {
+		t.Fatal("enable:", err)
+	}
+	if enabled, reloads := manager.isEnabled("test-gm.service"); !enabled || reloads != 1 {
+		t.Error("unit not enabled or daemon not reloaded")
+	}
+	if err := backend.Control("test-gm", RUN, true); err != nil {
+		t.Fatal("start:", err)
+	}
+	props, err := backend.Properties("test-gm", []string{FieldStatus, WORKDIR, "Unknown"}, true)
+	if err != nil {
+		t.Fatal("properties:", err)
+	}
+	if props[FieldStatus] != "running" || props[WORKDIR] != "/srv/test-gm.service" || props["Unknown"] != "" {
+		t.Error("unexpected properties:", props)
+	}
+	if err := backend.Control("test-gm", STOP, true); err != nil {
+		t.Fatal("stop:", err)
+	}
+	props, err = backend.Properties("test-gm", []string{FieldStatus}, true)
+	if err != nil {
+		t.Fatal("properties:", err)
+	}
+	if props[FieldStatus] != "dead" {
+		t.Error("unexpected status:", props[FieldStatus])
+	}
+	if err := backend.Control("test-gm", CmdDisable, true); err != nil {
+		t.Fatal("disable:", err)
+	}
+	if enabled, _ := manager.isEnabled("test-gm.service"); enabled {
+		t.Error("unit still enabled")
+	}
+}
+
+func TestDBusBackend_BusySystemd(t *testing.T) {
+	manager, backend := startFakeManager(t)
+	manager.noise = 200
+	done := make(chan error, 1)
+	go func() {
+		for _, operation := range []string{RUN, STOP, RESTART} {
+			if err := backend.Control("test-gm", operation, true); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("job completion is missed among other jobs")
+	}
+	if len(backend.jobs) != 1 {
+		t.Fatal("unexpected watchers:", backend.jobs)
+	}
+	for _, watcher := range backend.jobs {
+		watcher.lock.Lock()
+		if watcher.pending != 0 || len(watcher.results) != 0 || len(watcher.waiting) != 0 {
+			t.Error("results of jobs are kept:", watcher.pending, len(watcher.results), len(watcher.waiting))
+		}
+		watcher.lock.Unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package controler
+
+import "errors"
+
+var ErrNoDefinition = errors.New("service has no definition: it was attached, not created")
+
+func (cfg *Conf) Definition(name string) (NewService, error) {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	service, ok := cfg.Definitions[name]
+	if !ok {
+		return NewService{}, ErrNoDefinition
+	}
+	return service.clone(), nil
+}
+
+// reinstall regenerates unit of created service from definition, for example after unit was edited or removed
+func (cfg *Conf) reinstall(name string, by Actor) error {
+	service, err := cfg.Definition(name)
+	if err != nil {
+		return err
+	}
+	if err := cfg.install(service); err != nil {
+		return err
+	}
+	// enabling reloads units like systemctl daemon-reload
+	if err := cfg.backend.Control(name, CmdEnable, !cfg.Global); err != nil {
+		return err
+	}
+	cfg.Status(name) // actualize cache
+	cfg.emit(by, EventUpdated, name, "unit regenerated from definition")
+	return nil
+}
+
+// install service definition by backend or as systemd unit file if backend does not keep definitions
+func (cfg *Conf) install(service NewService) error {
+	if installer, ok := cfg.backend.(Installer); ok {
+		return installer.Install(service, !cfg.Global)
+	}
+	return writeUnit(service, !cfg.Global)
+}
+
+func (service NewService) clone() NewService {
+	if service.Environment != nil {
+		env := make(map[string]string, len(service.Environment))
+		for k, v := range service.Environment {
+			env[k] = v
+		}
+		service.Environment = env
+	}
+	return service
+}
@@ -0,0 +1,85 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConf_Definition(t *testing.T) {
+	controller, _, events := newTestController(t)
+	service := NewService{
+		Name:             "test-gm",
+		Command:          "/usr/bin/nc -v -l 9000",
+		WorkingDirectory: testData,
+		Environment:      map[string]string{"PORT": "9000"},
+		Restart:          "on-failure",
+	}
+	if err := controller.Create(service); err != nil {
+		t.Fatal("create service:", err)
+	}
+	definition, err := controller.Definition("test-gm")
+	if err != nil {
+		t.Fatal("definition:", err)
+	}
+	if !filepath.IsAbs(definition.WorkingDirectory) || definition.Command != service.Command ||
+		definition.Environment["PORT"] != "9000" || definition.Restart != "on-failure" {
+		t.Error("unexpected definition:", definition)
+	}
+	// definition is a copy
+	definition.Environment["PORT"] = "80"
+	if definition, _ := controller.Definition("test-gm"); definition.Environment["PORT"] != "9000" {
+		t.Error("definition changed by caller")
+	}
+
+	// unit removed by hand is regenerated
+	home, _ := os.UserHomeDir()
+	unitFile := filepath.Join(home, LocationUser, "test-gm.service")
+	if err := os.Remove(unitFile); err != nil {
+		t.Fatal(err)
+	}
+	// enabled and created
+	<-events
+	<-events
+	if err := controller.Reinstall("test-gm"); err != nil {
+		t.Fatal("reinstall:", err)
+	}
+	unit, err := ioutil.ReadFile(unitFile)
+	if err != nil {
+		t.Fatal("unit is not regenerated:", err)
+	}
+	if !strings.Contains(string(unit), "Environment=PORT=9000") || !strings.Contains(string(unit), "Restart=on-failure") {
+		t.Error("unexpected unit:", string(unit))
+	}
+	if event := <-events; event.Type != EventUpdated || event.Name != "test-gm" {
+		t.Error("unexpected event:", event)
+	}
+
+	// definition survives reload
+	if err := controller.Reload(); err != nil {
+		t.Fatal("reload:", err)
+	}
+	if _, err := controller.Definition("test-gm"); err != nil {
+		t.Error("definition after reload:", err)
+	}
+
+	// attached services have no definition
+	if err := controller.Attach("nginx"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	if _, err := controller.Definition("nginx"); err != ErrNoDefinition {
+		t.Error("definition of attached service:", err)
+	}
+	if err := controller.Reinstall("nginx"); err != ErrNoDefinition {
+		t.Error("reinstall of attached service:", err)
+	}
+
+	if err := controller.Forget("test-gm"); err != nil {
+		t.Fatal("forget:", err)
+	}
+	if _, err := controller.Definition("test-gm"); err != ErrNoDefinition {
+		t.Error("definition of forgotten service:", err)
+	}
+}
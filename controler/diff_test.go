@@ -0,0 +1,34 @@
+package controler
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	expected := `--- a
++++ b
+@@ -1,7 +1,7 @@
+ 1
+ 2
+ 3
+-4
++four
+ 5
+ 6
+ 7
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if diff := unifiedDiff("a", "b", a, b); diff != expected {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+	if diff := unifiedDiff("a", "b", "", "x\n"); diff != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("unexpected diff of new file:\n%s", diff)
+	}
+	if diff := unifiedDiff("a", "b", a, a); diff != "" {
+		t.Errorf("unexpected diff of equal texts:\n%s", diff)
+	}
+}
@@ -0,0 +1,429 @@
+package controler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DockerAPIVersion = "v1.40"
+	DockerStopWait   = 10             // seconds
+	DockerOldSuffix  = ".sukauto-old" // temporary name of container replaced by update
+)
+
+// DockerBackend manages containers through Docker Engine API. Service name is a container name
+type DockerBackend struct {
+	client  *http.Client
+	lock    sync.Mutex
+	stopped map[string]bool // containers stopped by request, their exit code is not a failure
+}
+
+// NewDockerBackend creates backend which talks to docker engine over unix socket
+func NewDockerBackend(socket string) *DockerBackend {
+	return &DockerBackend{
+		stopped: make(map[string]bool),
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+type dockerContainer struct {
+	ID    string `json:"Id"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		Pid       int    `json:"Pid"`
+		ExitCode  int    `json:"ExitCode"`
+		StartedAt string `json:"StartedAt"`
+	} `json:"State"`
+	RestartCount int                    `json:"RestartCount"`
+	Config       map[string]interface{} `json:"Config"`
+	HostConfig   map[string]interface{} `json:"HostConfig"`
+	Network      struct {
+		Networks map[string]dockerEndpoint `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerEndpoint is configuration of container in network which is kept when container is recreated
+type dockerEndpoint struct {
+	IPAMConfig interface{}       `json:"IPAMConfig,omitempty"`
+	Links      []string          `json:"Links,omitempty"`
+	Aliases    []string          `json:"Aliases,omitempty"`
+	DriverOpts map[string]string `json:"DriverOpts,omitempty"`
+}
+
+func (dc *dockerContainer) configString(field string) string {
+	v, _ := dc.Config[field].(string)
+	return v
+}
+
+// endpoints of container networks without alias by container id which docker adds by itself
+func (dc *dockerContainer) endpoints() map[string]dockerEndpoint {
+	short := dc.ID
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	ans := make(map[string]dockerEndpoint, len(dc.Network.Networks))
+	for network, endpoint := range dc.Network.Networks {
+		var aliases []string
+		for _, alias := range endpoint.Aliases {
+			if alias != short {
+				aliases = append(aliases, alias)
+			}
+		}
+		endpoint.Aliases = aliases
+		ans[network] = endpoint
+	}
+	return ans
+}
+
+func (dc *dockerContainer) restartPolicy() string {
+	policy, _ := dc.HostConfig["RestartPolicy"].(map[string]interface{})
+	name, _ := policy["Name"].(string)
+	return name
+}
+
+func (db *DockerBackend) Control(name string, operation string, user bool) error {
+	container := url.PathEscape(name)
+	switch operation {
+	case RUN:
+		db.setStopped(name, false)
+		return db.call(http.MethodPost, "/containers/"+container+"/start", nil, nil)
+	case STOP:
+		// container may exit with code of signal before request returns
+		db.setStopped(name, true)
+		return db.call(http.MethodPost, "/containers/"+container+"/stop?t="+strconv.Itoa(DockerStopWait), nil, nil)
+	case RESTART:
+		db.setStopped(name, false)
+		return db.call(http.MethodPost, "/containers/"+container+"/restart?t="+strconv.Itoa(DockerStopWait), nil, nil)
+	case CmdEnable:
+		return db.setRestartPolicy(container, "unless-stopped")
+	case CmdDisable:
+		return db.setRestartPolicy(container, "no")
+	default:
+		return errors.New("unsupported operation " + operation)
+	}
+}
+
+func (db *DockerBackend) Properties(name string, fields []string, user bool) (map[string]string, error) {
+	info, err := db.inspect(name)
+	if err != nil {
+		return nil, err
+	}
+	unitFileState := "disabled"
+	if policy := info.restartPolicy(); policy != "" && policy != "no" {
+		unitFileState = "enabled"
+	}
+	started := ""
+	if t, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil && t.Year() > 1 {
+		started = "@" + strconv.FormatInt(t.Unix(), 10)
+	}
+	state := dockerState(info.State.Status, info.State.ExitCode, db.isStopped(name))
+	all := map[string]string{
+		FieldStatus:         state,
+		FieldActiveState:    activeState(state),
+		FieldLoadState:      "loaded",
+		FieldStartTimestamp: started,
+		WORKDIR:             info.configString("WorkingDir"),
+		FieldMainPID:        strconv.Itoa(info.State.Pid),
+		FieldUnitFileState:  unitFileState,
+		FieldRestarts:       strconv.Itoa(info.RestartCount),
+		FieldExitStatus:     strconv.Itoa(info.State.ExitCode),
+	}
+	ans := make(map[string]string, len(fields))
+	for _, field := range fields {
+		ans[field] = all[field]
+	}
+	return ans, nil
+}
+
+func (db *DockerBackend) setStopped(name string, stopped bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if stopped {
+		db.stopped[name] = true
+	} else {
+		delete(db.stopped, name)
+	}
+}
+
+func (db *DockerBackend) isStopped(name string) bool {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.stopped[name]
+}
+
+func (db *DockerBackend) Log(name string, user bool) (string, error) {
+	info, err := db.inspect(name)
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	err = db.call(http.MethodGet, "/containers/"+url.PathEscape(name)+"/logs?stdout=1&stderr=1&tail="+strconv.Itoa(LogLimit), nil, out)
+	if err != nil {
+		return "", err
+	}
+	if tty, _ := info.Config["Tty"].(bool); tty {
+		return strings.TrimSpace(out.String()), nil
+	}
+	// non-tty logs are multiplexed
+	logs, err := demuxDockerStream(out.Bytes())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(logs), nil
+}
+
+// Install is not supported: containers should be created by docker itself and attached
+func (db *DockerBackend) Install(service NewService, user bool) error {
+	return errors.New("docker backend can not create services, create container and attach it")
+}
+
+// Update pulls image of container and recreates container with the same configuration and networks.
+// Old container is kept under temporary name until new one is started and restored if anything fails
+func (db *DockerBackend) Update(name string, user bool) error {
+	info, err := db.inspect(name)
+	if err != nil {
+		return err
+	}
+	image := info.configString("Image")
+	if image == "" {
+		return errors.New("container " + name + " has no image")
+	}
+	if err := db.pull(image); err != nil {
+		return err
+	}
+	old := name + DockerOldSuffix
+	if err := db.rename(name, old); err != nil {
+		return err
+	}
+	restore := func(cause error) error {
+		// new container may be not created yet
+		db.call(http.MethodDelete, "/containers/"+url.PathEscape(name)+"?force=1", nil, nil)
+		if err := db.rename(old, name); err != nil {
+			return fmt.Errorf("%v; restore container %s: %v", cause, name, err)
+		}
+		if info.State.Running {
+			if err := db.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil); err != nil {
+				return fmt.Errorf("%v; start restored container %s: %v", cause, name, err)
+			}
+		}
+		return cause
+	}
+	if err := db.create(name, info); err != nil {
+		return restore(err)
+	}
+	if info.State.Running {
+		if err := db.call(http.MethodPost, "/containers/"+url.PathEscape(old)+"/stop?t="+strconv.Itoa(DockerStopWait), nil, nil); err != nil {
+			return restore(err)
+		}
+		if err := db.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil); err != nil {
+			return restore(err)
+		}
+	}
+	return db.call(http.MethodDelete, "/containers/"+url.PathEscape(old), nil, nil)
+}
+
+// create container with configuration of inspected one. Docker API before 1.44 accepts single network on
+// create, so network of network mode is set on create and others are connected after
+func (db *DockerBackend) create(name string, info *dockerContainer) error {
+	spec := make(map[string]interface{}, len(info.Config)+2)
+	for k, v := range info.Config {
+		spec[k] = v
+	}
+	spec["HostConfig"] = info.HostConfig
+	primary, _ := info.HostConfig["NetworkMode"].(string)
+	if primary == "default" {
+		primary = "bridge"
+	}
+	endpoints := info.endpoints()
+	if endpoint, ok := endpoints[primary]; ok {
+		spec["NetworkingConfig"] = map[string]interface{}{
+			"EndpointsConfig": map[string]dockerEndpoint{primary: endpoint},
+		}
+		delete(endpoints, primary)
+	}
+	if err := db.call(http.MethodPost, "/containers/create?name="+url.QueryEscape(name), spec, nil); err != nil {
+		return err
+	}
+	networks := make([]string, 0, len(endpoints))
+	for network := range endpoints {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		connect := map[string]interface{}{"Container": name, "EndpointConfig": endpoints[network]}
+		if err := db.call(http.MethodPost, "/networks/"+url.PathEscape(network)+"/connect", connect, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DockerBackend) rename(name string, to string) error {
+	return db.call(http.MethodPost, "/containers/"+url.PathEscape(name)+"/rename?name="+url.QueryEscape(to), nil, nil)
+}
+
+func (db *DockerBackend) inspect(name string) (*dockerContainer, error) {
+	out := &bytes.Buffer{}
+	err := db.call(http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, out)
+	if err != nil {
+		return nil, err
+	}
+	var info dockerContainer
+	return &info, json.Unmarshal(out.Bytes(), &info)
+}
+
+func (db *DockerBackend) setRestartPolicy(container string, policy string) error {
+	var update struct {
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+	}
+	update.RestartPolicy.Name = policy
+	return db.call(http.MethodPost, "/containers/"+container+"/update", update, nil)
+}
+
+func (db *DockerBackend) pull(image string) error {
+	name, tag := splitImage(image)
+	query := url.Values{"fromImage": {name}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	out := &bytes.Buffer{}
+	err := db.call(http.MethodPost, "/images/create?"+query.Encode(), nil, out)
+	if err != nil {
+		return err
+	}
+	// progress is streamed as JSON messages, errors are reported inside of stream
+	decoder := json.NewDecoder(out)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		err = decoder.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New("pull " + image + ": " + msg.Error)
+		}
+	}
+}
+
+// call docker API. Request body (if not nil) is encoded as JSON, response body is copied to out (if not nil)
+func (db *DockerBackend) call(method string, path string, body interface{}, out io.Writer) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://docker/"+DockerAPIVersion+path, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := db.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// 304 - container already started/stopped
+	if res.StatusCode >= http.StatusBadRequest {
+		var msg struct {
+			Message string `json:"message"`
+		}
+		data, _ := ioutil.ReadAll(res.Body)
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = string(data)
+		}
+		return fmt.Errorf("docker %s %s: %d %s", method, path, res.StatusCode, msg.Message)
+	}
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, res.Body)
+		return err
+	}
+	_, err = io.Copy(out, res.Body)
+	return err
+}
+
+// dockerState maps container status onto systemd sub-states. Exited container is failed only if it exited with
+// non-zero code by itself: container stopped by request exits with code of signal (137 or 143)
+func dockerState(status string, exitCode int, stopped bool) string {
+	switch status {
+	case "running":
+		return StateRunning
+	case "restarting":
+		return StateAutoRestart
+	case "exited":
+		if exitCode != 0 && !stopped {
+			return StateFailed
+		}
+		return StateDead
+	case "dead":
+		return StateFailed
+	case "":
+		return StateUnknown
+	default:
+		return StateDead
+	}
+}
+
+// demuxDockerStream joins stdout and stderr frames: each frame has 8 bytes header (stream type, 3 zero bytes and
+// big-endian payload size)
+func demuxDockerStream(data []byte) (string, error) {
+	out := &strings.Builder{}
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return "", errors.New("truncated docker stream header")
+		}
+		size := int(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+		if len(data) < size {
+			return "", errors.New("truncated docker stream frame")
+		}
+		out.Write(data[:size])
+		data = data[size:]
+	}
+	return out.String(), nil
+}
+
+// splitImage splits image reference to name and tag for pulling. References with digest are not split
+func splitImage(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return image, "latest"
+	}
+	return image[:i], image[i+1:]
+}
@@ -0,0 +1,348 @@
+package controler
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDocker emulates subset of Docker Engine API
+type fakeDocker struct {
+	lock       sync.Mutex
+	containers map[string]*fakeContainer
+	pulled     []string
+	created    int
+	failCreate bool
+	failStart  bool
+}
+
+type fakeContainer struct {
+	id       string
+	status   string
+	exitCode int
+	policy   string
+	image    string
+	networks map[string]dockerEndpoint
+}
+
+func (fd *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fd.lock.Lock()
+	defer fd.lock.Unlock()
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"+DockerAPIVersion+"/"), "/")
+	if len(path) == 2 && path[0] == "images" && path[1] == "create" && r.Method == http.MethodPost {
+		fd.pulled = append(fd.pulled, r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag"))
+		w.Write([]byte(`{"status":"Pulling"}` + "\n" + `{"status":"Done"}`))
+		return
+	}
+	if len(path) == 2 && path[0] == "containers" && path[1] == "create" && r.Method == http.MethodPost {
+		var spec struct {
+			Image            string
+			HostConfig       map[string]interface{}
+			NetworkingConfig struct {
+				EndpointsConfig map[string]dockerEndpoint
+			}
+		}
+		json.NewDecoder(r.Body).Decode(&spec)
+		name := r.URL.Query().Get("name")
+		if fd.failCreate || spec.Image == "" || spec.HostConfig == nil || len(spec.NetworkingConfig.EndpointsConfig) > 1 {
+			http.Error(w, `{"message":"bad spec"}`, http.StatusBadRequest)
+			return
+		}
+		if _, ok := fd.containers[name]; ok {
+			http.Error(w, `{"message":"name is already in use"}`, http.StatusConflict)
+			return
+		}
+		fd.created++
+		fd.containers[name] = &fakeContainer{
+			id:       "new0123456789abcdef",
+			status:   "created",
+			policy:   "no",
+			image:    spec.Image,
+			networks: spec.NetworkingConfig.EndpointsConfig,
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"new0123456789abcdef"}`))
+		return
+	}
+	if len(path) == 3 && path[0] == "networks" && path[2] == "connect" && r.Method == http.MethodPost {
+		var connect struct {
+			Container      string
+			EndpointConfig dockerEndpoint
+		}
+		json.NewDecoder(r.Body).Decode(&connect)
+		container, ok := fd.containers[connect.Container]
+		if !ok {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		if container.networks == nil {
+			container.networks = make(map[string]dockerEndpoint)
+		}
+		container.networks[path[1]] = connect.EndpointConfig
+		return
+	}
+	if len(path) < 2 || path[0] != "containers" {
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+		return
+	}
+	name := path[1]
+	container, ok := fd.containers[name]
+	if !ok {
+		http.Error(w, `{"message":"No such container: `+name+`"}`, http.StatusNotFound)
+		return
+	}
+	action := ""
+	if len(path) > 2 {
+		action = path[2]
+	}
+	switch {
+	case r.Method == http.MethodGet && action == "json":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":           container.id,
+			"State":        map[string]interface{}{"Status": container.status, "Running": container.status == "running", "Pid": 42, "ExitCode": container.exitCode},
+			"RestartCount": 2,
+			"Config":       map[string]interface{}{"Image": container.image, "WorkingDir": "/app", "Tty": false},
+			"HostConfig": map[string]interface{}{
+				"RestartPolicy": map[string]interface{}{"Name": container.policy},
+				"NetworkMode":   "backend",
+			},
+			"NetworkSettings": map[string]interface{}{"Networks": container.networks},
+		})
+	case r.Method == http.MethodGet && action == "logs":
+		for _, line := range []string{"hello\n", "world\n"} {
+			header := make([]byte, 8)
+			header[0] = 1
+			binary.BigEndian.PutUint32(header[4:], uint32(len(line)))
+			w.Write(header)
+			w.Write([]byte(line))
+		}
+	case r.Method == http.MethodPost && action == "start":
+		if fd.failStart && container.status == "created" {
+			http.Error(w, `{"message":"port is already allocated"}`, http.StatusInternalServerError)
+			return
+		}
+		container.status = "running"
+		container.exitCode = 0
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "stop":
+		container.status = "exited"
+		container.exitCode = 143
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "restart":
+		container.status = "running"
+		container.exitCode = 0
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "rename":
+		to := r.URL.Query().Get("name")
+		if _, ok := fd.containers[to]; ok {
+			http.Error(w, `{"message":"name is already in use"}`, http.StatusConflict)
+			return
+		}
+		delete(fd.containers, name)
+		fd.containers[to] = container
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && action == "update":
+		var update struct {
+			RestartPolicy struct{ Name string }
+		}
+		json.NewDecoder(r.Body).Decode(&update)
+		container.policy = update.RestartPolicy.Name
+		w.Write([]byte(`{"Warnings":[]}`))
+	case r.Method == http.MethodDelete && action == "":
+		delete(fd.containers, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+	}
+}
+
+func startFakeDocker(t *testing.T, fake *fakeDocker) *DockerBackend {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(fake)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return NewDockerBackend(socket)
+}
+
+func newFakeWeb() *fakeContainer {
+	return &fakeContainer{
+		id:     "old0123456789abcdef",
+		status: "exited",
+		policy: "no",
+		image:  "example/web:1.2",
+		networks: map[string]dockerEndpoint{
+			"backend": {Aliases: []string{"web", "old012345678"}},
+			"metrics": {Aliases: []string{"web-metrics"}},
+		},
+	}
+}
+
+func TestDockerBackend(t *testing.T) {
+	fake := &fakeDocker{containers: map[string]*fakeContainer{"web": newFakeWeb()}}
+	backend := startFakeDocker(t, fake)
+	fields := []string{FieldStatus, WORKDIR, FieldUnitFileState}
+	props, err := backend.Properties("web", fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props[FieldStatus] != StateDead || props[WORKDIR] != "/app" || props[FieldUnitFileState] != "disabled" {
+		t.Error("unexpected properties:", props)
+	}
+	if err := backend.Control("web", RUN, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Control("web", CmdEnable, false); err != nil {
+		t.Fatal(err)
+	}
+	props, err = backend.Properties("web", fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props[FieldStatus] != StateRunning || props[FieldUnitFileState] != "enabled" {
+		t.Error("unexpected properties:", props)
+	}
+	log, err := backend.Log("web", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log != "hello\nworld" {
+		t.Error("unexpected log:", log)
+	}
+
+	if err := backend.Update("web", false); err != nil {
+		t.Fatal(err)
+	}
+	web := fake.containers["web"]
+	if fake.created != 1 || web == nil || web.status != "running" || len(fake.pulled) != 1 || fake.pulled[0] != "example/web:1.2" {
+		t.Fatal("container not recreated:", fake.created, web, fake.pulled)
+	}
+	if len(fake.containers) != 1 {
+		t.Error("old container is kept:", fake.containers)
+	}
+	if aliases := web.networks["backend"].Aliases; len(aliases) != 1 || aliases[0] != "web" {
+		t.Error("unexpected aliases in backend network:", aliases)
+	}
+	if aliases := web.networks["metrics"].Aliases; len(aliases) != 1 || aliases[0] != "web-metrics" {
+		t.Error("unexpected aliases in metrics network:", aliases)
+	}
+
+	if _, err := backend.Properties("unknown", fields, false); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Error("expected not found error, got", err)
+	}
+}
+
+func TestDockerUpdateRestoresContainer(t *testing.T) {
+	fake := &fakeDocker{containers: map[string]*fakeContainer{"web": newFakeWeb()}}
+	fake.containers["web"].status = "running"
+	backend := startFakeDocker(t, fake)
+
+	fake.failCreate = true
+	if err := backend.Update("web", false); err == nil {
+		t.Error("update should fail")
+	}
+	if web := fake.containers["web"]; len(fake.containers) != 1 || web == nil || web.id != "old0123456789abcdef" || web.status != "running" {
+		t.Error("container is not restored after failed create:", fake.containers)
+	}
+
+	fake.failCreate = false
+	fake.failStart = true
+	if err := backend.Update("web", false); err == nil {
+		t.Error("update should fail")
+	}
+	if web := fake.containers["web"]; len(fake.containers) != 1 || web == nil || web.id != "old0123456789abcdef" || web.status != "running" {
+		t.Error("container is not restored after failed start:", fake.containers)
+	}
+}
+
+func TestDockerState(t *testing.T) {
+	cases := []struct {
+		status   string
+		exitCode int
+		stopped  bool
+		expected string
+	}{
+		{"running", 0, false, StateRunning},
+		{"restarting", 1, false, StateAutoRestart},
+		{"created", 0, false, StateDead},
+		{"exited", 0, false, StateDead},
+		{"exited", 1, false, StateFailed},
+		{"exited", 137, false, StateFailed},
+		{"exited", 137, true, StateDead},
+		{"exited", 143, true, StateDead},
+		{"dead", 0, false, StateFailed},
+		{"", 0, false, StateUnknown},
+	}
+	for _, c := range cases {
+		if state := dockerState(c.status, c.exitCode, c.stopped); state != c.expected {
+			t.Errorf("status %s, exit code %d, stopped %v: got %s, expected %s", c.status, c.exitCode, c.stopped, state, c.expected)
+		}
+	}
+}
+
+func TestDockerStoppedByRequest(t *testing.T) {
+	fake := &fakeDocker{containers: map[string]*fakeContainer{"web": newFakeWeb()}}
+	backend := startFakeDocker(t, fake)
+	fields := []string{FieldStatus, FieldActiveState}
+	if err := backend.Control("web", RUN, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Control("web", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+	props, err := backend.Properties("web", fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props[FieldStatus] != StateDead || props[FieldActiveState] != "inactive" {
+		t.Error("stopped container is reported as:", props)
+	}
+	if err := backend.Control("web", RUN, false); err != nil {
+		t.Fatal(err)
+	}
+	// crashed by itself
+	fake.lock.Lock()
+	fake.containers["web"].status = "exited"
+	fake.containers["web"].exitCode = 2
+	fake.lock.Unlock()
+	props, err = backend.Properties("web", fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props[FieldStatus] != StateFailed || props[FieldActiveState] != "failed" {
+		t.Error("crashed container is reported as:", props)
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	cases := map[string][2]string{
+		"nginx":                     {"nginx", "latest"},
+		"nginx:1.19":                {"nginx", "1.19"},
+		"registry:5000/app":         {"registry:5000/app", "latest"},
+		"registry:5000/app:v2":      {"registry:5000/app", "v2"},
+		"nginx@sha256:0123456789ab": {"nginx@sha256:0123456789ab", ""},
+	}
+	for image, expected := range cases {
+		name, tag := splitImage(image)
+		if name != expected[0] || tag != expected[1] {
+			t.Error(image, "splitted to", name, tag)
+		}
+	}
+}
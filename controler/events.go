@@ -3,12 +3,13 @@ package controler
 import (
 	"encoding/json"
 	"strings"
+	"time"
 )
 
 //go:generate go-enum -f=$GOFILE --marshal --lower
 /*
 ENUM(
-Created, Removed, Started, Restarted, Stopped, Updated, Enabled, Disabled, Joined, Leaved
+Created, Removed, Started, Restarted, Stopped, Updated, Enabled, Disabled, Joined, Leaved, LoginFailed, Modified
 )
 */
 type Event int
@@ -27,8 +28,12 @@ func (x *Event) UnmarshalJSON(data []byte) error {
 }
 
 type SystemEvent struct {
-	Type Event  `json:"type"`
-	Name string `json:"name"`
+	Type    Event     `json:"type"`
+	Name    string    `json:"name"`
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"`  // who initiated event: HTTP user, telegram user id
+	Origin  string    `json:"origin,omitempty"` // api, telegram, background, script
+	Details string    `json:"details,omitempty"`
 }
 
 func WithStateFilter(events <-chan SystemEvent) <-chan SystemEvent {
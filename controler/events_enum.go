@@ -1,49 +1,60 @@
-// Code generated by go-enum
-// DO NOT EDIT!
+// Code generated by go-enum DO NOT EDIT.
+// Version: v0.9.5
+
+// Built By: go install
 
 package controler
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
 
 const (
-	// EventCreated is a Event of type Created
+	// EventCreated is a Event of type Created.
 	EventCreated Event = iota
-	// EventRemoved is a Event of type Removed
+	// EventRemoved is a Event of type Removed.
 	EventRemoved
-	// EventStarted is a Event of type Started
+	// EventStarted is a Event of type Started.
 	EventStarted
-	// EventRestarted is a Event of type Restarted
+	// EventRestarted is a Event of type Restarted.
 	EventRestarted
-	// EventStopped is a Event of type Stopped
+	// EventStopped is a Event of type Stopped.
 	EventStopped
-	// EventUpdated is a Event of type Updated
+	// EventUpdated is a Event of type Updated.
 	EventUpdated
-	// EventEnabled is a Event of type Enabled
+	// EventEnabled is a Event of type Enabled.
 	EventEnabled
-	// EventDisabled is a Event of type Disabled
+	// EventDisabled is a Event of type Disabled.
 	EventDisabled
-	// EventJoined is a Event of type Joined
+	// EventJoined is a Event of type Joined.
 	EventJoined
-	// EventLeaved is a Event of type Leaved
+	// EventLeaved is a Event of type Leaved.
 	EventLeaved
+	// EventLoginFailed is a Event of type LoginFailed.
+	EventLoginFailed
+	// EventModified is a Event of type Modified.
+	EventModified
 )
 
-const _EventName = "CreatedRemovedStartedRestartedStoppedUpdatedEnabledDisabledJoinedLeaved"
+var ErrInvalidEvent = errors.New("not a valid Event")
+
+const _EventName = "CreatedRemovedStartedRestartedStoppedUpdatedEnabledDisabledJoinedLeavedLoginFailedModified"
 
 var _EventMap = map[Event]string{
-	0: _EventName[0:7],
-	1: _EventName[7:14],
-	2: _EventName[14:21],
-	3: _EventName[21:30],
-	4: _EventName[30:37],
-	5: _EventName[37:44],
-	6: _EventName[44:51],
-	7: _EventName[51:59],
-	8: _EventName[59:65],
-	9: _EventName[65:71],
+	EventCreated:     _EventName[0:7],
+	EventRemoved:     _EventName[7:14],
+	EventStarted:     _EventName[14:21],
+	EventRestarted:   _EventName[21:30],
+	EventStopped:     _EventName[30:37],
+	EventUpdated:     _EventName[37:44],
+	EventEnabled:     _EventName[44:51],
+	EventDisabled:    _EventName[51:59],
+	EventJoined:      _EventName[59:65],
+	EventLeaved:      _EventName[65:71],
+	EventLoginFailed: _EventName[71:82],
+	EventModified:    _EventName[82:90],
 }
 
 // String implements the Stringer interface.
@@ -54,43 +65,54 @@ func (x Event) String() string {
 	return fmt.Sprintf("Event(%d)", x)
 }
 
+// IsValid provides a quick way to determine if the typed value is
+// part of the allowed enumerated values
+func (x Event) IsValid() bool {
+	_, ok := _EventMap[x]
+	return ok
+}
+
 var _EventValue = map[string]Event{
-	_EventName[0:7]:                    0,
-	strings.ToLower(_EventName[0:7]):   0,
-	_EventName[7:14]:                   1,
-	strings.ToLower(_EventName[7:14]):  1,
-	_EventName[14:21]:                  2,
-	strings.ToLower(_EventName[14:21]): 2,
-	_EventName[21:30]:                  3,
-	strings.ToLower(_EventName[21:30]): 3,
-	_EventName[30:37]:                  4,
-	strings.ToLower(_EventName[30:37]): 4,
-	_EventName[37:44]:                  5,
-	strings.ToLower(_EventName[37:44]): 5,
-	_EventName[44:51]:                  6,
-	strings.ToLower(_EventName[44:51]): 6,
-	_EventName[51:59]:                  7,
-	strings.ToLower(_EventName[51:59]): 7,
-	_EventName[59:65]:                  8,
-	strings.ToLower(_EventName[59:65]): 8,
-	_EventName[65:71]:                  9,
-	strings.ToLower(_EventName[65:71]): 9,
+	_EventName[0:7]:                    EventCreated,
+	strings.ToLower(_EventName[0:7]):   EventCreated,
+	_EventName[7:14]:                   EventRemoved,
+	strings.ToLower(_EventName[7:14]):  EventRemoved,
+	_EventName[14:21]:                  EventStarted,
+	strings.ToLower(_EventName[14:21]): EventStarted,
+	_EventName[21:30]:                  EventRestarted,
+	strings.ToLower(_EventName[21:30]): EventRestarted,
+	_EventName[30:37]:                  EventStopped,
+	strings.ToLower(_EventName[30:37]): EventStopped,
+	_EventName[37:44]:                  EventUpdated,
+	strings.ToLower(_EventName[37:44]): EventUpdated,
+	_EventName[44:51]:                  EventEnabled,
+	strings.ToLower(_EventName[44:51]): EventEnabled,
+	_EventName[51:59]:                  EventDisabled,
+	strings.ToLower(_EventName[51:59]): EventDisabled,
+	_EventName[59:65]:                  EventJoined,
+	strings.ToLower(_EventName[59:65]): EventJoined,
+	_EventName[65:71]:                  EventLeaved,
+	strings.ToLower(_EventName[65:71]): EventLeaved,
+	_EventName[71:82]:                  EventLoginFailed,
+	strings.ToLower(_EventName[71:82]): EventLoginFailed,
+	_EventName[82:90]:                  EventModified,
+	strings.ToLower(_EventName[82:90]): EventModified,
 }
 
-// ParseEvent attempts to convert a string to a Event
+// ParseEvent attempts to convert a string to a Event.
 func ParseEvent(name string) (Event, error) {
 	if x, ok := _EventValue[name]; ok {
 		return x, nil
 	}
-	return Event(0), fmt.Errorf("%s is not a valid Event", name)
+	return Event(0), fmt.Errorf("%s is %w", name, ErrInvalidEvent)
 }
 
-// MarshalText implements the text marshaller method
-func (x *Event) MarshalText() ([]byte, error) {
+// MarshalText implements the text marshaller method.
+func (x Event) MarshalText() ([]byte, error) {
 	return []byte(x.String()), nil
 }
 
-// UnmarshalText implements the text unmarshaller method
+// UnmarshalText implements the text unmarshaller method.
 func (x *Event) UnmarshalText(text []byte) error {
 	name := string(text)
 	tmp, err := ParseEvent(name)
@@ -100,3 +122,11 @@ func (x *Event) UnmarshalText(text []byte) error {
 	*x = tmp
 	return nil
 }
+
+// AppendText appends the textual representation of itself to the end of b
+// (allocating a larger slice if necessary) and returns the updated slice.
+//
+// Implementations must not retain b, nor mutate any bytes within b[:len(b)].
+func (x Event) AppendText(b []byte) ([]byte, error) {
+	return append(b, x.String()...), nil
+}
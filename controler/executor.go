@@ -0,0 +1,30 @@
+package controler
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Executor runs external commands (systemctl, journalctl, update command) on behalf of controller
+type Executor interface {
+	// Execute command with arguments in working directory (empty means current) and return stdout
+	Execute(dir string, command string, args ...string) (string, error)
+}
+
+// SystemExecutor runs commands as local processes. Stderr is redirected to current process stderr
+type SystemExecutor struct{}
+
+func (SystemExecutor) Execute(dir string, command string, args ...string) (string, error) {
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = io.Writer(stdout)
+	cmd.Stderr = os.Stderr
+	cmd.Dir = dir
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,222 @@
+package controler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTOMLComments is returned on save of TOML config with comments, because TOML encoder can't keep them
+var ErrTOMLComments = errors.New("TOML config has comments which would be lost, remove them or use YAML config")
+
+// configFormat converts config file between its own format and JSON
+type configFormat interface {
+	// toJSON decodes content of file to JSON
+	toJSON(data []byte) ([]byte, error)
+	// fromJSON encodes JSON to content of file. Comments of previous content are kept if format allows
+	fromJSON(data []byte, previous []byte) ([]byte, error)
+}
+
+// formatOf config file by extension: .yaml, .yml, .toml or JSON for anything else
+func formatOf(location string) configFormat {
+	switch strings.ToLower(filepath.Ext(location)) {
+	case ".yaml", ".yml":
+		return yamlFormat{}
+	case ".toml":
+		return tomlFormat{}
+	}
+	return jsonFormat{}
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) toJSON(data []byte) ([]byte, error) { return data, nil }
+
+func (jsonFormat) fromJSON(data []byte, previous []byte) ([]byte, error) { return data, nil }
+
+type yamlFormat struct{}
+
+func (yamlFormat) toJSON(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func (yamlFormat) fromJSON(data []byte, previous []byte) ([]byte, error) {
+	// JSON is a valid YAML in flow style
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+	var old yaml.Node
+	if err := yaml.Unmarshal(previous, &old); err == nil {
+		mergeComments(&old, &doc)
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// blockStyle replaces flow style of JSON by block style, strings are quoted only if needed
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// mergeComments copies comments from old document to new one and keeps old order of mapping keys
+func mergeComments(old, node *yaml.Node) {
+	node.HeadComment = old.HeadComment
+	node.LineComment = old.LineComment
+	node.FootComment = old.FootComment
+	switch {
+	case node.Kind == yaml.DocumentNode && old.Kind == yaml.DocumentNode && len(node.Content) == 1 && len(old.Content) == 1:
+		mergeComments(old.Content[0], node.Content[0])
+	case node.Kind == yaml.MappingNode && old.Kind == yaml.MappingNode:
+		pairs := make(map[string][2]*yaml.Node)
+		var order []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs[node.Content[i].Value] = [2]*yaml.Node{node.Content[i], node.Content[i+1]}
+			order = append(order, node.Content[i].Value)
+		}
+		content := make([]*yaml.Node, 0, len(node.Content))
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			key := old.Content[i].Value
+			pair, ok := pairs[key]
+			if !ok {
+				continue
+			}
+			mergeComments(old.Content[i], pair[0])
+			mergeComments(old.Content[i+1], pair[1])
+			content = append(content, pair[0], pair[1])
+			delete(pairs, key)
+		}
+		for _, key := range order {
+			if pair, ok := pairs[key]; ok {
+				content = append(content, pair[0], pair[1])
+			}
+		}
+		node.Content = content
+	case node.Kind == yaml.SequenceNode && old.Kind == yaml.SequenceNode:
+		// items are matched by scalar value, other items by position
+		scalars := make(map[string]*yaml.Node)
+		for _, item := range old.Content {
+			if item.Kind == yaml.ScalarNode {
+				scalars[item.Value] = item
+			}
+		}
+		for i, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				if prev, ok := scalars[item.Value]; ok {
+					mergeComments(prev, item)
+				}
+			} else if i < len(old.Content) {
+				mergeComments(old.Content[i], item)
+			}
+		}
+	}
+}
+
+type tomlFormat struct{}
+
+func (tomlFormat) toJSON(data []byte) ([]byte, error) {
+	var value map[string]interface{}
+	if err := toml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func (tomlFormat) fromJSON(data []byte, previous []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value map[string]interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if tomlHasComments(previous) {
+		return nil, ErrTOMLComments
+	}
+	var out bytes.Buffer
+	if err := toml.NewEncoder(&out).Encode(tomlValue(value)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// tomlHasComments checks for comments out of strings
+func tomlHasComments(data []byte) bool {
+	text := string(data)
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '#':
+			return true
+		case '"', '\'':
+			quote := text[i : i+1]
+			if strings.HasPrefix(text[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			i += len(quote)
+			for i < len(text) && !strings.HasPrefix(text[i:], quote) {
+				if text[i] == '\\' && quote[0] == '"' {
+					i++
+				}
+				i++
+			}
+			i += len(quote) - 1
+		}
+	}
+	return false
+}
+
+// warnComments warns on load of config which can't be saved without loss of comments
+func warnComments(location string, data []byte) {
+	if _, ok := formatOf(location).(tomlFormat); ok && tomlHasComments(data) {
+		fmt.Printf("[MONITOR]: Warning: TOML config %s has comments, changes of config are refused to keep them\n", location)
+	}
+}
+
+// tomlValue converts JSON value to value which TOML can encode: numbers are typed, nulls are dropped
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		ans := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item != nil {
+				ans[key] = tomlValue(item)
+			}
+		}
+		return ans
+	case []interface{}:
+		ans := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				ans = append(ans, tomlValue(item))
+			}
+		}
+		return ans
+	}
+	return value
+}
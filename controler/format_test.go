@@ -0,0 +1,132 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFormatController(t *testing.T, name, content string) (AccessServiceController, string) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	location := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(location, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	controller := NewServiceControllerWithExecutor(location, "", newFakeSystemd())
+	go func() {
+		for range controller.Events() {
+		}
+	}()
+	return controller, location
+}
+
+func TestConf_YAML(t *testing.T) {
+	controller, location := newFormatController(t, "config.yml", `# managed by ansible
+version: 1
+global: true # system units
+services:
+  - web # frontend
+  - db
+groups:
+  # services of backend
+  backend: [db]
+users:
+  alice: secret
+`)
+	if err := controller.Attach("cache"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	data, _ := ioutil.ReadFile(location)
+	saved := string(data)
+	for _, expected := range []string{"# managed by ansible", "global: true # system units", "- web # frontend", "- cache", "# services of backend"} {
+		if !strings.Contains(saved, expected) {
+			t.Errorf("%q is lost", expected)
+		}
+	}
+	if strings.Contains(saved, "secret") {
+		t.Error("password is not hashed")
+	}
+	if strings.Index(saved, "global:") > strings.Index(saved, "services:") {
+		t.Error("order of keys is not kept")
+	}
+
+	reloaded := NewServiceControllerWithExecutor(location, "", newFakeSystemd()).(*Conf)
+	if len(reloaded.Services) != 3 || !reloaded.Global || len(reloaded.GroupsList["backend"]) != 1 {
+		t.Error("unexpected reloaded config:", reloaded.Services, reloaded.Global, reloaded.GroupsList)
+	}
+	if err := reloaded.Login("alice", "secret"); err != nil {
+		t.Error("login:", err)
+	}
+}
+
+func TestConf_TOML(t *testing.T) {
+	controller, location := newFormatController(t, "config.toml", `version = 1
+global = true
+services = ["web"]
+
+[users]
+alice = "secret"
+
+[roles.alice]
+role = "operator"
+`)
+	if err := controller.Attach("db"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	if _, err := controller.CreateToken(Token{Name: "ci", Owner: "alice", Actions: []string{"run"}}); err != nil {
+		t.Fatal("create token:", err)
+	}
+	reloaded := NewServiceControllerWithExecutor(location, "", newFakeSystemd()).(*Conf)
+	if len(reloaded.Services) != 2 || !reloaded.Global || reloaded.Version != ConfigVersion {
+		t.Error("unexpected reloaded config:", reloaded.Services, reloaded.Global, reloaded.Version)
+	}
+	if role := reloaded.Role("alice", "web"); role != RoleOperator {
+		t.Error("unexpected role:", role)
+	}
+	if tokens := reloaded.ListTokens(); len(tokens) != 1 || tokens[0].Name != "ci" {
+		t.Error("unexpected tokens:", tokens)
+	}
+	if problems, err := ValidateConfigFile(location); err != nil || len(problems) != 0 {
+		t.Error("unexpected problems:", problems, err)
+	}
+}
+
+func TestConf_TOMLComments(t *testing.T) {
+	content := `# managed by ansible
+version = 1
+services = ["web"] # frontend
+
+[users]
+alice = "secret"
+`
+	// passwords are hashed in memory only
+	controller, location := newFormatController(t, "config.toml", content)
+	if err := controller.Login("alice", "secret"); err != nil {
+		t.Error("login:", err)
+	}
+	if err := controller.Attach("db"); err != ErrTOMLComments {
+		t.Error("config with comments is saved:", err)
+	}
+	if data, _ := ioutil.ReadFile(location); string(data) != content {
+		t.Error("config with comments is changed:", string(data))
+	}
+
+	// hash in strings is not a comment
+	controller, _ = newFormatController(t, "config.toml", `version = 1
+services = ["web"]
+
+[certificates]
+"team#1" = 'alice#laptop'
+"quote\"#" = """
+#multiline"""
+`)
+	if err := controller.Attach("db"); err != nil {
+		t.Error("attach:", err)
+	}
+}
@@ -0,0 +1,167 @@
+package controler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	maxGuardKeys   = 10000 // tracked keys, the oldest ones are forgotten when exceeded
+	maxTrustedKeys = 16    // trusted sources per key
+)
+
+// LoginGuard tracks failed login attempts by keys (client address, user name, ...). After max attempts key is
+// locked out, each next failure doubles lockout duration up to max lockout
+type LoginGuard struct {
+	maxAttempts int
+	lockout     time.Duration
+	maxLockout  time.Duration
+	lock        sync.Mutex
+	attempts    map[string]*loginAttempts
+	trusted     map[string]map[string]time.Time // key -> source -> last successful login
+}
+
+type loginAttempts struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+func NewLoginGuard(maxAttempts int, lockout, maxLockout time.Duration) *LoginGuard {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	if maxLockout < lockout {
+		maxLockout = lockout
+	}
+	return &LoginGuard{
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
+		maxLockout:  maxLockout,
+		attempts:    make(map[string]*loginAttempts),
+		trusted:     make(map[string]map[string]time.Time),
+	}
+}
+
+// Locked returns the longest remaining lockout of keys or zero
+func (lg *LoginGuard) Locked(keys ...string) time.Duration {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+	now := time.Now()
+	var ans time.Duration
+	for _, key := range keys {
+		if att, ok := lg.attempts[key]; ok && att.until.After(now) && att.until.Sub(now) > ans {
+			ans = att.until.Sub(now)
+		}
+	}
+	return ans
+}
+
+// Fail registers failed attempt for keys and returns max number of failures in a row
+func (lg *LoginGuard) Fail(keys ...string) int {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+	now := time.Now()
+	lg.cleanup(now)
+	var ans int
+	for _, key := range keys {
+		att, ok := lg.attempts[key]
+		if !ok {
+			if len(lg.attempts) >= maxGuardKeys {
+				lg.forgetOldest()
+			}
+			att = &loginAttempts{}
+			lg.attempts[key] = att
+		}
+		att.failures++
+		att.last = now
+		if over := att.failures - lg.maxAttempts; over >= 0 {
+			lockout := lg.lockout
+			for i := 0; i < over && lockout < lg.maxLockout; i++ {
+				lockout *= 2
+			}
+			if lockout > lg.maxLockout {
+				lockout = lg.maxLockout
+			}
+			att.until = now.Add(lockout)
+		}
+		if att.failures > ans {
+			ans = att.failures
+		}
+	}
+	return ans
+}
+
+// Reset failures of keys after successful login
+func (lg *LoginGuard) Reset(keys ...string) {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+	for _, key := range keys {
+		delete(lg.attempts, key)
+	}
+}
+
+// Trust remembers source (client address) of successful login by key (user name). Failures of key from trusted
+// sources are not counted and its lockout is not applied to them, so user can't be locked out of own addresses
+func (lg *LoginGuard) Trust(key string, source string) {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+	sources, ok := lg.trusted[key]
+	if !ok {
+		if len(lg.trusted) >= maxGuardKeys {
+			lg.forgetOldestTrusted()
+		}
+		sources = make(map[string]time.Time)
+		lg.trusted[key] = sources
+	}
+	if _, ok := sources[source]; !ok && len(sources) >= maxTrustedKeys {
+		var oldest string
+		for src, last := range sources {
+			if oldest == "" || last.Before(sources[oldest]) {
+				oldest = src
+			}
+		}
+		delete(sources, oldest)
+	}
+	sources[source] = time.Now()
+}
+
+// Trusted checks that key had successful login from source
+func (lg *LoginGuard) Trusted(key string, source string) bool {
+	lg.lock.Lock()
+	defer lg.lock.Unlock()
+	_, ok := lg.trusted[key][source]
+	return ok
+}
+
+func (lg *LoginGuard) forgetOldest() {
+	var oldest string
+	for key, att := range lg.attempts {
+		if oldest == "" || att.last.Before(lg.attempts[oldest].last) {
+			oldest = key
+		}
+	}
+	delete(lg.attempts, oldest)
+}
+
+func (lg *LoginGuard) forgetOldestTrusted() {
+	var oldest string
+	var oldestTime time.Time
+	for key, sources := range lg.trusted {
+		for _, last := range sources {
+			if oldest == "" || last.Before(oldestTime) {
+				oldest, oldestTime = key, last
+			}
+		}
+	}
+	delete(lg.trusted, oldest)
+}
+
+// cleanup forgets keys without failures during max lockout
+func (lg *LoginGuard) cleanup(now time.Time) {
+	for key, att := range lg.attempts {
+		if now.Sub(att.last) > lg.maxLockout && now.After(att.until) {
+			delete(lg.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package controler
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoginGuard(t *testing.T) {
+	guard := NewLoginGuard(3, time.Minute, 5*time.Minute)
+	for i := 1; i < 3; i++ {
+		if failures := guard.Fail("ip:1", "user:bob"); failures != i {
+			t.Error("unexpected failures:", failures)
+		}
+		if wait := guard.Locked("ip:1"); wait != 0 {
+			t.Fatal("locked before max attempts:", wait)
+		}
+	}
+	guard.Fail("ip:1", "user:bob")
+	if wait := guard.Locked("user:bob"); wait <= 0 || wait > time.Minute {
+		t.Error("unexpected lockout:", wait)
+	}
+	guard.Fail("ip:1")
+	if wait := guard.Locked("ip:1"); wait <= time.Minute || wait > 2*time.Minute {
+		t.Error("lockout not doubled:", wait)
+	}
+	for i := 0; i < 10; i++ {
+		guard.Fail("ip:1")
+	}
+	if wait := guard.Locked("ip:1"); wait > 5*time.Minute {
+		t.Error("lockout over max:", wait)
+	}
+	if wait := guard.Locked("ip:2"); wait != 0 {
+		t.Error("unknown key locked:", wait)
+	}
+	guard.Reset("ip:1", "user:bob")
+	if wait := guard.Locked("ip:1", "user:bob"); wait != 0 {
+		t.Error("locked after reset:", wait)
+	}
+}
+
+func TestLoginGuard_Trust(t *testing.T) {
+	guard := NewLoginGuard(1, time.Minute, time.Hour)
+	guard.Trust("user:bob", "10.0.0.1")
+	if !guard.Trusted("user:bob", "10.0.0.1") || guard.Trusted("user:bob", "10.0.0.2") || guard.Trusted("user:alice", "10.0.0.1") {
+		t.Error("unexpected trusted sources")
+	}
+	for i := 0; i < maxTrustedKeys; i++ {
+		guard.Trust("user:bob", "192.0.2."+strconv.Itoa(i))
+	}
+	if guard.Trusted("user:bob", "10.0.0.1") {
+		t.Error("the oldest source is kept over limit")
+	}
+
+	// sprayed keys don't grow guard over limit
+	for i := 0; i < maxGuardKeys+10; i++ {
+		guard.Fail("user:" + strconv.Itoa(i))
+	}
+	if len(guard.attempts) > maxGuardKeys {
+		t.Error("too many tracked keys:", len(guard.attempts))
+	}
+	if guard.Locked("user:"+strconv.Itoa(maxGuardKeys+9)) == 0 {
+		t.Error("the newest key is not locked")
+	}
+}
@@ -0,0 +1,115 @@
+package controler
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	HistoryFile    = "events.jsonl"
+	historyMaxSize = 10 * 1024 * 1024
+	historyKeep    = 5
+)
+
+// HistoryFilter for events query. Zero fields mean no filtering, but empty non-nil Services matches nothing
+type HistoryFilter struct {
+	Services []string
+	Types    []Event
+	From     time.Time
+	To       time.Time
+	Offset   int
+	Limit    int
+}
+
+// HistoryPage is a part of matched events (newest first) and total number of matched events
+type HistoryPage struct {
+	Events []SystemEvent `json:"events"`
+	Total  int           `json:"total"`
+}
+
+// History is an append-only events store: one JSON record per line. File is rotated, so only the latest
+// events are retained
+type History struct {
+	log rotatingLog
+}
+
+// NewHistory creates history. Non-positive max size (bytes) and keep (number of rotated files) mean defaults
+func NewHistory(location string, maxSize int64, keep int) *History {
+	if maxSize <= 0 {
+		maxSize = historyMaxSize
+	}
+	if keep <= 0 {
+		keep = historyKeep
+	}
+	return &History{log: rotatingLog{location: location, maxSize: maxSize, keep: keep}}
+}
+
+func (h *History) Append(event SystemEvent) error {
+	return h.log.append(event)
+}
+
+// Query events by filter. Events are ordered from newest to oldest
+func (h *History) Query(filter HistoryFilter) (HistoryPage, error) {
+	ans := HistoryPage{Events: make([]SystemEvent, 0)}
+	page, total, err := h.log.page(filter.Offset, filter.Limit, func(line []byte) (interface{}, bool) {
+		var event SystemEvent
+		if json.Unmarshal(line, &event) != nil {
+			return nil, false
+		}
+		return event, filter.match(event)
+	})
+	ans.Total = total
+	for _, event := range page {
+		ans.Events = append(ans.Events, event.(SystemEvent))
+	}
+	return ans, err
+}
+
+func (filter *HistoryFilter) match(record SystemEvent) bool {
+	if !filter.From.IsZero() && record.Time.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && record.Time.After(filter.To) {
+		return false
+	}
+	if filter.Services != nil && !containsString(filter.Services, record.Name) {
+		return false
+	}
+	if len(filter.Types) == 0 {
+		return true
+	}
+	for _, tp := range filter.Types {
+		if tp == record.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// WithHistory saves all events to history
+func WithHistory(events <-chan SystemEvent, history *History) <-chan SystemEvent {
+	ans := make(chan SystemEvent)
+	go func() {
+		defer close(ans)
+		for event := range events {
+			if event.Time.IsZero() {
+				event.Time = time.Now()
+			}
+			if err := history.Append(event); err != nil {
+				log.Println("failed save event to history:", err)
+			}
+			ans <- event
+		}
+	}()
+	return ans
+}
+
+func containsString(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	history := NewHistory(filepath.Join(dir, HistoryFile), 0, 0)
+
+	page, err := history.Query(HistoryFilter{})
+	if err != nil || page.Total != 0 || len(page.Events) != 0 {
+		t.Fatal("unexpected empty history:", page, err)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	events := []SystemEvent{
+		{Type: EventStarted, Name: "alpha"},
+		{Type: EventStopped, Name: "alpha"},
+		{Type: EventStarted, Name: "beta"},
+		{Type: EventUpdated, Name: "alpha"},
+		{Type: EventStopped, Name: "beta"},
+	}
+	for i, event := range events {
+		event.Time = start.Add(time.Duration(i) * time.Minute)
+		err = history.Append(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err = history.Query(HistoryFilter{Services: []string{"alpha"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || page.Events[0].Type != EventUpdated || page.Events[2].Type != EventStarted {
+		t.Error("unexpected events of alpha:", page)
+	}
+
+	page, err = history.Query(HistoryFilter{Types: []Event{EventStopped}, From: start.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Events[0].Name != "beta" {
+		t.Error("unexpected stopped events:", page)
+	}
+
+	page, err = history.Query(HistoryFilter{Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 || len(page.Events) != 2 || page.Events[0].Type != EventUpdated || page.Events[1].Name != "beta" {
+		t.Error("unexpected page:", page)
+	}
+
+	page, err = history.Query(HistoryFilter{Services: []string{}})
+	if err != nil || page.Total != 0 {
+		t.Error("empty group should match nothing:", page, err)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// each event is rotated to own file
+	history := NewHistory(filepath.Join(dir, HistoryFile), 1, 2)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := history.Append(SystemEvent{Type: EventStarted, Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := history.Query(HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 3 || page.Events[0].Name != "e" || page.Events[2].Name != "c" {
+		t.Error("unexpected retained events:", page)
+	}
+
+	// scan works on snapshot of files and doesn't block appends
+	var scanned []string
+	err = history.log.scan(func(line []byte) {
+		scanned = append(scanned, string(line))
+		if err := history.Append(SystemEvent{Type: EventStopped, Name: "f"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scanned) != 3 {
+		t.Error("unexpected scanned lines:", scanned)
+	}
+}
@@ -0,0 +1,185 @@
+package controler
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apr1Magic = "$apr1$"
+
+// HTPasswd is a provider which authenticates users by Apache htpasswd file (bcrypt, apr1 and SHA1 hashes).
+// File is re-read when it is changed
+type HTPasswd struct {
+	location string
+	lock     sync.Mutex
+	modTime  time.Time
+	users    map[string]string
+}
+
+func NewHTPasswd(location string) (*HTPasswd, error) {
+	ht := &HTPasswd{location: location}
+	return ht, ht.reload()
+}
+
+func (ht *HTPasswd) Login(username string, password string) error {
+	ht.lock.Lock()
+	err := ht.reload()
+	hash, ok := ht.users[username]
+	ht.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok || !checkHTPasswd(hash, password) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+func (ht *HTPasswd) HasUser(username string) (bool, error) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	if err := ht.reload(); err != nil {
+		return false, err
+	}
+	_, ok := ht.users[username]
+	return ok, nil
+}
+
+func (ht *HTPasswd) UserStamp(username string) (string, error) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	if err := ht.reload(); err != nil {
+		return "", err
+	}
+	hash, ok := ht.users[username]
+	if !ok {
+		return "", errors.New("no user " + username)
+	}
+	return credentialStamp(hash), nil
+}
+
+// reload file if it was modified
+func (ht *HTPasswd) reload() error {
+	info, err := os.Stat(ht.location)
+	if err != nil {
+		return err
+	}
+	if ht.users != nil && info.ModTime().Equal(ht.modTime) {
+		return nil
+	}
+	f, err := os.Open(ht.location)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			users[parts[0]] = parts[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	ht.users = users
+	ht.modTime = info.ModTime()
+	return nil
+}
+
+func checkHTPasswd(hash string, password string) bool {
+	switch {
+	case isHashed(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, apr1Magic):
+		salt := strings.SplitN(strings.TrimPrefix(hash, apr1Magic), "$", 2)[0]
+		return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(hash)) == 1
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+	return false
+}
+
+// apr1 is Apache variant of MD5-crypt
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	ctx := md5.New()
+	ctx.Write(pw)
+	ctx.Write([]byte(apr1Magic))
+	ctx.Write([]byte(salt))
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(altSum)
+		} else {
+			ctx.Write(altSum[:i])
+		}
+	}
+	for i := len(pw); i != 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	out := make([]byte, 0, 22)
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(final[group[0]])<<16|uint(final[group[1]])<<8|uint(final[group[2]]), 4)
+	}
+	encode(uint(final[11]), 2)
+	return apr1Magic + salt + "$" + string(out)
+}
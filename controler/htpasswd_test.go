@@ -0,0 +1,47 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTPasswd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "htpasswd")
+	bcrypted, _ := HashPassword("bcrypt-pass")
+	content := strings.Join([]string{
+		"# comment",
+		"alice:" + bcrypted,
+		"bob:$apr1$x8kPq0Lz$7mbcVfcXBek1iEb3hiMeM.",
+		"carol:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+	}, "\n")
+	if err := ioutil.WriteFile(location, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewHTPasswd(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"alice", "bcrypt-pass", true},
+		{"alice", "wrong", false},
+		{"bob", "secret", true},
+		{"bob", "secret2", false},
+		{"carol", "password", true},
+		{"dave", "", false},
+	} {
+		if err := provider.Login(check.user, check.password); (err == nil) != check.ok {
+			t.Error("unexpected login result:", check, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package controler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// rotatingLog is an append-only JSONL file. When file exceeds max size it is rotated:
+// file -> file.1 -> ... -> file.N (removed)
+type rotatingLog struct {
+	location string
+	maxSize  int64
+	keep     int
+	lock     sync.Mutex
+}
+
+// append value as line and rotate file if needed
+func (rl *rotatingLog) append(value interface{}) error {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+	if info, err := os.Stat(rl.location); err == nil && info.Size() >= rl.maxSize {
+		if err := rl.rotate(); err != nil {
+			return err
+		}
+	}
+	return appendJSONLine(rl.location, value)
+}
+
+// scan calls handler for each line from the oldest file to the current one. Files are opened under lock and
+// read up to their size at that moment, so long scans don't block appends and rotation
+func (rl *rotatingLog) scan(handler func(line []byte)) error {
+	type snapshot struct {
+		file *os.File
+		size int64
+	}
+	var files []snapshot
+	defer func() {
+		for _, f := range files {
+			f.file.Close()
+		}
+	}()
+	rl.lock.Lock()
+	for i := rl.keep; i >= 0; i-- {
+		f, err := os.Open(rl.file(i))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			rl.lock.Unlock()
+			return err
+		}
+		files = append(files, snapshot{file: f})
+		info, err := f.Stat()
+		if err != nil {
+			rl.lock.Unlock()
+			return err
+		}
+		files[len(files)-1].size = info.Size()
+	}
+	rl.lock.Unlock()
+	for _, f := range files {
+		scanner := bufio.NewScanner(io.LimitReader(f.file, f.size))
+		for scanner.Scan() {
+			handler(scanner.Bytes())
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// page of matched lines, newest first, and total number of matched lines. Match decodes line and tells whether
+// it passes filter, lines which can't be decoded (partially written) are skipped. Offset skips the newest
+// matches, zero limit means all of them
+func (rl *rotatingLog) page(offset, limit int, match func(line []byte) (interface{}, bool)) ([]interface{}, int, error) {
+	var total int
+	var matched []interface{}
+	err := rl.scan(func(line []byte) {
+		value, ok := match(line)
+		if !ok {
+			return
+		}
+		total++
+		// only the newest values are needed for the page
+		matched = append(matched, value)
+		if limit > 0 && len(matched) > offset+limit {
+			matched = matched[1:]
+		}
+	})
+	if err != nil {
+		return nil, total, err
+	}
+	var ans []interface{}
+	for i := len(matched) - 1 - offset; i >= 0; i-- {
+		if limit > 0 && len(ans) >= limit {
+			break
+		}
+		ans = append(ans, matched[i])
+	}
+	return ans, total, nil
+}
+
+func (rl *rotatingLog) rotate() error {
+	err := os.Remove(rl.file(rl.keep))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := rl.keep - 1; i >= 0; i-- {
+		err = os.Rename(rl.file(i), rl.file(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// file name of rotated log. Zero is the current file
+func (rl *rotatingLog) file(index int) string {
+	if index == 0 {
+		return rl.location
+	}
+	return rl.location + "." + strconv.Itoa(index)
+}
+
+// appendJSONLine appends value as single JSON line to file
+func appendJSONLine(location string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(location, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,62 @@
+package controler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRotatingLog_Page(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// small size rotates log on each few lines
+	rl := &rotatingLog{location: filepath.Join(dir, "log.jsonl"), maxSize: 10, keep: 10}
+	for i := 1; i <= 7; i++ {
+		if err := rl.append(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// partially written line
+	f, err := os.OpenFile(rl.location, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{\"broken\n")
+	f.Close()
+
+	odd := func(line []byte) (interface{}, bool) {
+		var value int
+		if json.Unmarshal(line, &value) != nil {
+			return nil, false
+		}
+		return value, value%2 == 1
+	}
+	for _, check := range []struct {
+		offset, limit int
+		expected      []interface{}
+	}{
+		{0, 0, []interface{}{7, 5, 3, 1}},
+		{0, 2, []interface{}{7, 5}},
+		{1, 2, []interface{}{5, 3}},
+		{3, 2, []interface{}{1}},
+		{4, 2, nil},
+		{10, 0, nil},
+	} {
+		page, total, err := rl.page(check.offset, check.limit, odd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 4 || !reflect.DeepEqual(page, check.expected) {
+			t.Error("offset", check.offset, "limit", check.limit, "unexpected page:", page, total)
+		}
+	}
+	if _, err := os.Stat(rl.file(1)); err != nil {
+		t.Error("log is not rotated:", err)
+	}
+}
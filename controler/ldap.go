@@ -0,0 +1,229 @@
+package controler
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultRoleTTL = time.Minute
+
+var errNoMappedGroup = errors.New("user is not a member of any mapped group")
+
+// LDAPOptions of LDAP provider
+type LDAPOptions struct {
+	URL          string // ldap://host:389 or ldaps://host:636
+	StartTLS     bool
+	BindDN       string // service account to find users and groups (anonymous if empty)
+	BindPassword string
+	BaseDN       string
+	UserFilter   string // %s is replaced by user name, for example (uid=%s)
+	GroupFilter  string // %s is replaced by user DN, for example (member=%s)
+	GroupAttr    string // attribute with group name, for example cn
+	Roles        map[string]Role
+	RoleTTL      time.Duration // how long role found in directory is cached
+}
+
+// LDAP is a provider which authenticates users by bind to directory and maps directory groups to roles
+type LDAP struct {
+	options LDAPOptions
+	lock    sync.RWMutex
+	roles   map[string]cachedRole
+}
+
+type cachedRole struct {
+	role Role
+	at   time.Time
+}
+
+func NewLDAP(options LDAPOptions) *LDAP {
+	if options.UserFilter == "" {
+		options.UserFilter = "(uid=%s)"
+	}
+	if options.GroupFilter == "" {
+		options.GroupFilter = "(member=%s)"
+	}
+	if options.GroupAttr == "" {
+		options.GroupAttr = "cn"
+	}
+	if options.RoleTTL <= 0 {
+		options.RoleTTL = defaultRoleTTL
+	}
+	return &LDAP{options: options, roles: make(map[string]cachedRole)}
+}
+
+func (ld *LDAP) Login(username string, password string) error {
+	if username == "" || password == "" {
+		// empty password means unauthenticated bind
+		return ErrInvalidCredentials
+	}
+	conn, err := ld.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := ld.bindService(conn); err != nil {
+		return err
+	}
+	userDN, err := ld.findUser(conn, username)
+	if err != nil {
+		return err
+	}
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	if len(ld.options.Roles) == 0 {
+		return nil
+	}
+	// user may have no rights to search groups
+	if err := ld.bindService(conn); err != nil {
+		return err
+	}
+	role, err := ld.findRole(conn, userDN)
+	if err != nil {
+		return err
+	}
+	ld.cacheRole(username, role)
+	return nil
+}
+
+// UserRole of user by directory groups. Without mapping of groups provider doesn't know roles. With mapping
+// users unknown to directory have no role. Role is cached for RoleTTL
+func (ld *LDAP) UserRole(username string) (Role, bool) {
+	if len(ld.options.Roles) == 0 {
+		return RoleNone, false
+	}
+	ld.lock.RLock()
+	cached, ok := ld.roles[username]
+	ld.lock.RUnlock()
+	if ok && time.Since(cached.at) < ld.options.RoleTTL {
+		return cached.role, true
+	}
+	role, err := ld.lookupRole(username)
+	if err != nil {
+		log.Println("failed get role of", username, "from directory:", err)
+		return RoleNone, true
+	}
+	ld.cacheRole(username, role)
+	return role, true
+}
+
+// HasUser in directory, found by service account
+func (ld *LDAP) HasUser(username string) (bool, error) {
+	conn, err := ld.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if err := ld.bindService(conn); err != nil {
+		return false, err
+	}
+	_, err = ld.findUser(conn, username)
+	if err == ErrInvalidCredentials {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lookupRole of user in directory by service account
+func (ld *LDAP) lookupRole(username string) (Role, error) {
+	conn, err := ld.dial()
+	if err != nil {
+		return RoleNone, err
+	}
+	defer conn.Close()
+	if err := ld.bindService(conn); err != nil {
+		return RoleNone, err
+	}
+	userDN, err := ld.findUser(conn, username)
+	if err == ErrInvalidCredentials {
+		return RoleNone, nil
+	}
+	if err != nil {
+		return RoleNone, err
+	}
+	role, err := ld.findRole(conn, userDN)
+	if err == errNoMappedGroup {
+		return RoleNone, nil
+	}
+	return role, err
+}
+
+func (ld *LDAP) cacheRole(username string, role Role) {
+	ld.lock.Lock()
+	defer ld.lock.Unlock()
+	now := time.Now()
+	for name, cached := range ld.roles {
+		if now.Sub(cached.at) >= ld.options.RoleTTL {
+			delete(ld.roles, name)
+		}
+	}
+	ld.roles[username] = cachedRole{role: role, at: now}
+}
+
+func (ld *LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(ld.options.URL)
+	if err != nil {
+		return nil, err
+	}
+	if ld.options.StartTLS {
+		if err := conn.StartTLS(&tls.Config{}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (ld *LDAP) bindService(conn *ldap.Conn) error {
+	if ld.options.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(ld.options.BindDN, ld.options.BindPassword)
+}
+
+func (ld *LDAP) findUser(conn *ldap.Conn, username string) (string, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		ld.options.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(ld.options.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return "", err
+	}
+	if len(result.Entries) != 1 {
+		return "", ErrInvalidCredentials
+	}
+	return result.Entries[0].DN, nil
+}
+
+// findRole is a max role of user groups. User without mapped groups has no role
+func (ld *LDAP) findRole(conn *ldap.Conn, userDN string) (Role, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		ld.options.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(ld.options.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{ld.options.GroupAttr}, nil,
+	))
+	if err != nil {
+		return RoleNone, err
+	}
+	role := RoleNone
+	for _, entry := range result.Entries {
+		for _, group := range entry.GetAttributeValues(ld.options.GroupAttr) {
+			if mapped, ok := ld.options.Roles[group]; ok && mapped > role {
+				role = mapped
+			}
+		}
+	}
+	if role == RoleNone {
+		return role, errNoMappedGroup
+	}
+	return role, nil
+}
@@ -0,0 +1,237 @@
+package controler
+
+import (
+	"github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeDirectory is a minimal in-process LDAP server: simple bind and search by exact filter
+type fakeDirectory struct {
+	listener  net.Listener
+	passwords map[string]string            // DN -> password
+	entries   map[string]map[string]string // filter -> DN -> group name
+}
+
+func newFakeDirectory(t *testing.T) *fakeDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &fakeDirectory{
+		listener: listener,
+		passwords: map[string]string{
+			"cn=sukauto,dc=example,dc=com":          "service",
+			"uid=alice,ou=people,dc=example,dc=com": "alice-pass",
+			"uid=bob,ou=people,dc=example,dc=com":   "bob-pass",
+		},
+		entries: map[string]map[string]string{
+			"(uid=alice)": {"uid=alice,ou=people,dc=example,dc=com": ""},
+			"(uid=bob)":   {"uid=bob,ou=people,dc=example,dc=com": ""},
+			"(member=uid=alice,ou=people,dc=example,dc=com)": {
+				"cn=devops,ou=groups,dc=example,dc=com": "devops",
+				"cn=staff,ou=groups,dc=example,dc=com":  "staff",
+			},
+			"(member=uid=bob,ou=people,dc=example,dc=com)": {
+				"cn=staff,ou=groups,dc=example,dc=com": "staff",
+			},
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fd.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return fd
+}
+
+func (fd *fakeDirectory) URL() string {
+	return "ldap://" + fd.listener.Addr().String()
+}
+
+func (fd *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultSuccess)
+			if expected, ok := fd.passwords[dn]; dn != "" && (!ok || expected != password) {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			fd.reply(conn, id, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			attr := ""
+			if attrs := op.Children[7].Children; len(attrs) > 0 {
+				attr = attrs[0].Data.String()
+			}
+			for dn, group := range fd.entries[filter] {
+				envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+				attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				if group != "" {
+					attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+					attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr, ""))
+					values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+					values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, group, ""))
+					attribute.AppendChild(values)
+					attributes.AppendChild(attribute)
+				}
+				entry.AppendChild(attributes)
+				envelope.AppendChild(entry)
+				conn.Write(envelope.Bytes())
+			}
+			fd.reply(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (fd *fakeDirectory) reply(conn net.Conn, id int64, tag ber.Tag, code uint16) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(code), ""))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	envelope.AppendChild(response)
+	conn.Write(envelope.Bytes())
+}
+
+func TestLDAP(t *testing.T) {
+	directory := newFakeDirectory(t)
+	provider := NewLDAP(LDAPOptions{
+		URL:          directory.URL(),
+		BindDN:       "cn=sukauto,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+		Roles:        map[string]Role{"devops": RoleAdmin, "staff": RoleViewer},
+	})
+	if err := provider.Login("alice", "alice-pass"); err != nil {
+		t.Fatal("login:", err)
+	}
+	if role, ok := provider.UserRole("alice"); !ok || role != RoleAdmin {
+		t.Error("unexpected role of alice:", role, ok)
+	}
+	if err := provider.Login("bob", "bob-pass"); err != nil {
+		t.Fatal("login:", err)
+	}
+	if role, ok := provider.UserRole("bob"); !ok || role != RoleViewer {
+		t.Error("unexpected role of bob:", role, ok)
+	}
+	if err := provider.Login("bob", "wrong"); err != ErrInvalidCredentials {
+		t.Error("login with wrong password:", err)
+	}
+	if err := provider.Login("bob", ""); err != ErrInvalidCredentials {
+		t.Error("login with empty password:", err)
+	}
+	if err := provider.Login("mallory", "pass"); err != ErrInvalidCredentials {
+		t.Error("login of unknown user:", err)
+	}
+
+	access := WithProvider(&Conf{Roles: map[string]UserRole{"bob": {Role: RoleOperator}}}, provider)
+	if role := access.Role("bob", "web"); role != RoleViewer {
+		t.Error("provider role should replace configured one:", role)
+	}
+	if role := access.Role("carol", ""); role != RoleNone {
+		t.Error("user unknown to directory has role:", role)
+	}
+	if role := access.GroupRole("carol", "frontend"); role != RoleNone {
+		t.Error("user unknown to directory has group role:", role)
+	}
+}
+
+func TestLDAP_RoleLookup(t *testing.T) {
+	directory := newFakeDirectory(t)
+	provider := NewLDAP(LDAPOptions{
+		URL:          directory.URL(),
+		BindDN:       "cn=sukauto,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+		Roles:        map[string]Role{"devops": RoleAdmin, "staff": RoleViewer},
+		RoleTTL:      50 * time.Millisecond,
+	})
+	// users of tokens and certificates never log in
+	if role, ok := provider.UserRole("bob"); !ok || role != RoleViewer {
+		t.Error("unexpected role of bob:", role, ok)
+	}
+	directory.entries["(member=uid=bob,ou=people,dc=example,dc=com)"] = map[string]string{
+		"cn=devops,ou=groups,dc=example,dc=com": "devops",
+	}
+	if role, _ := provider.UserRole("bob"); role != RoleViewer {
+		t.Error("cached role is not used:", role)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if role, _ := provider.UserRole("bob"); role != RoleAdmin {
+		t.Error("role is not updated after TTL:", role)
+	}
+	delete(directory.entries, "(member=uid=bob,ou=people,dc=example,dc=com)")
+	time.Sleep(60 * time.Millisecond)
+	if role, ok := provider.UserRole("bob"); !ok || role != RoleNone {
+		t.Error("user out of mapped groups has role:", role, ok)
+	}
+
+	unmapped := NewLDAP(LDAPOptions{URL: directory.URL(), BaseDN: "dc=example,dc=com"})
+	if _, ok := unmapped.UserRole("alice"); ok {
+		t.Error("provider without mapping knows roles")
+	}
+}
+
+func TestLDAP_WithoutMapping(t *testing.T) {
+	directory := newFakeDirectory(t)
+	provider := NewLDAP(LDAPOptions{
+		URL:          directory.URL(),
+		BindDN:       "cn=sukauto,dc=example,dc=com",
+		BindPassword: "service",
+		BaseDN:       "dc=example,dc=com",
+	})
+	// config users are not users of provider
+	conf := &Conf{Users: map[string]string{DefaultUser: "hash"}, Certificates: map[string]string{"bob-laptop": "bob"}}
+	access := WithProvider(conf, provider)
+	if role := access.Role("alice", "web"); role != RoleViewer {
+		t.Error("directory user without configured roles is not a viewer:", role)
+	}
+	if role := access.GroupRole("alice", "frontend"); role != RoleViewer {
+		t.Error("directory user without configured roles is not a viewer of group:", role)
+	}
+	for commonName, expected := range map[string]string{"alice": "alice", "bob-laptop": "bob"} {
+		if user, err := access.CertificateUser(commonName); err != nil || user != expected {
+			t.Error("certificate of directory user:", commonName, user, err)
+		}
+	}
+	for _, commonName := range []string{"mallory", DefaultUser} {
+		if user, err := access.CertificateUser(commonName); err == nil {
+			t.Error("certificate of user unknown to directory is accepted:", commonName, user)
+		}
+	}
+	if user, err := access.PeerUser(0); err != nil || user != DefaultUser {
+		t.Error("root peer:", user, err)
+	}
+
+	// admin is granted explicitly
+	conf.Roles = map[string]UserRole{"alice": {Role: RoleAdmin}}
+	if role := access.Role("alice", "web"); role != RoleAdmin {
+		t.Error("configured role is not applied:", role)
+	}
+	if role := access.Role("bob", "web"); role != RoleViewer {
+		t.Error("unexpected role of user without configured role:", role)
+	}
+}
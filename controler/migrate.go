@@ -0,0 +1,174 @@
+package controler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigVersion is a current version of config schema
+const ConfigVersion = 1
+
+// migrations of raw config: migrations[i] upgrades config of version i to version i+1
+var migrations = []func(raw map[string]interface{}) error{
+	// 0 -> 1: unversioned config, structure is the same
+	func(raw map[string]interface{}) error { return nil },
+}
+
+// decodeConfig decodes content of config file and upgrades it to current version.
+// Returns true if config was upgraded
+func decodeConfig(data []byte, cfg *Conf) (bool, error) {
+	raw, upgraded, err := upgradeConfig(data)
+	if err != nil {
+		return false, err
+	}
+	if !upgraded {
+		return false, json.Unmarshal(data, cfg)
+	}
+	return true, remarshal(raw, cfg)
+}
+
+// ValidateConfig checks content of config file and returns found problems: unknown keys, duplicated services,
+// groups referencing unknown services and so on. Config of older version is checked after upgrade
+func ValidateConfig(data []byte) ([]string, error) {
+	raw, _, err := upgradeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Conf
+	if err := remarshal(raw, &cfg); err != nil {
+		return nil, err
+	}
+	problems := unknownKeys(raw, reflect.TypeOf(&cfg), "")
+	return append(problems, cfg.problems()...), nil
+}
+
+// ValidateConfigFile checks config file in any supported format
+func ValidateConfigFile(location string) ([]string, error) {
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = formatOf(location).toJSON(data); err != nil {
+		return nil, err
+	}
+	return ValidateConfig(data)
+}
+
+// upgradeConfig decodes config as a generic JSON object and applies migrations
+func upgradeConfig(data []byte) (map[string]interface{}, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, false, err
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+	var version int64
+	if value, ok := raw["version"]; ok {
+		number, isNumber := value.(json.Number)
+		if !isNumber {
+			return nil, false, fmt.Errorf("invalid config version %v", value)
+		}
+		var err error
+		if version, err = number.Int64(); err != nil || version < 0 {
+			return nil, false, fmt.Errorf("invalid config version %v", value)
+		}
+	}
+	if version > ConfigVersion {
+		return nil, false, fmt.Errorf("config version %d is newer than supported %d", version, ConfigVersion)
+	}
+	for v := version; v < ConfigVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return nil, false, fmt.Errorf("upgrade config to version %d: %v", v+1, err)
+		}
+	}
+	raw["version"] = ConfigVersion
+	return raw, version < ConfigVersion, nil
+}
+
+func remarshal(raw map[string]interface{}, cfg *Conf) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+// unknownKeys of JSON value which are not fields of type
+func unknownKeys(value interface{}, tp reflect.Type, path string) []string {
+	for tp.Kind() == reflect.Ptr {
+		tp = tp.Elem()
+	}
+	var ans []string
+	switch tp.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			// struct with custom encoding, like time
+			return nil
+		}
+		fields := jsonFields(tp)
+		for _, key := range sortedKeys(obj) {
+			field, ok := fields[key]
+			if !ok {
+				ans = append(ans, "unknown key "+joinPath(path, key))
+				continue
+			}
+			ans = append(ans, unknownKeys(obj[key], field, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		obj, _ := value.(map[string]interface{})
+		for _, key := range sortedKeys(obj) {
+			ans = append(ans, unknownKeys(obj[key], tp.Elem(), joinPath(path, key))...)
+		}
+	case reflect.Slice:
+		list, _ := value.([]interface{})
+		for i, item := range list {
+			ans = append(ans, unknownKeys(item, tp.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return ans
+}
+
+// jsonFields of struct by JSON name
+func jsonFields(tp reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < tp.NumField(); i++ {
+		field := tp.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
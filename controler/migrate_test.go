@@ -0,0 +1,78 @@
+package controler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConf_Upgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "config.json")
+	legacy := []byte(`{"services": ["web"], "global": true, "users": {}}`)
+	if err := ioutil.WriteFile(location, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+	controller := NewServiceControllerWithExecutor(location, "", newFakeSystemd())
+
+	var saved Conf
+	data, _ := ioutil.ReadFile(location)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != ConfigVersion || !saved.Global || len(saved.Services) != 1 {
+		t.Error("unexpected upgraded config:", string(data))
+	}
+	// original is kept
+	backups, err := controller.Backups()
+	if err != nil || len(backups) != 1 {
+		t.Fatal("unexpected backups:", backups, err)
+	}
+	original, _ := ioutil.ReadFile(location + "." + backups[0].Revision)
+	if string(original) != string(legacy) {
+		t.Error("unexpected backup content:", string(original))
+	}
+
+	// newer config is rejected
+	var cfg Conf
+	if _, err := decodeConfig([]byte(`{"version": 1000}`), &cfg); err == nil {
+		t.Error("newer config accepted")
+	}
+	if _, err := decodeConfig([]byte(`{"version": "one"}`), &cfg); err == nil {
+		t.Error("invalid version accepted")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	problems, err := ValidateConfig([]byte(`{
+		"version": 1,
+		"services": ["web", "db", "web"],
+		"groups": {"backend": ["db", "cache"]},
+		"roles": {"alice": {"role": "admin", "group": {}}},
+		"tokens": [{"name": "ci", "hash": "abc", "owner": "alice", "actions": ["run"], "scope": "all"}],
+		"sevices": []
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"unknown key roles.alice.group",
+		"unknown key sevices",
+		"unknown key tokens[0].scope",
+		"duplicated service web",
+		"group backend refers to unknown service cache",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("unexpected problems:\n%q\n%q", problems, expected)
+	}
+	if _, err := ValidateConfig([]byte(`{"services": "web"}`)); err == nil {
+		t.Error("invalid config accepted")
+	}
+}
@@ -0,0 +1,151 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ServiceChange is a result of service modification
+type ServiceChange struct {
+	Diff      string `json:"diff"` // unified diff of unit content, empty if nothing changed
+	Restarted bool   `json:"restarted"`
+}
+
+func (cfg *Conf) modify(service NewService, restart bool, by Actor) (ServiceChange, error) {
+	var change ServiceChange
+	fields, diff, err := cfg.replaceDefinition(service)
+	if err != nil {
+		return change, err
+	}
+	change.Diff = diff
+	if len(fields) > 0 || diff != "" {
+		cfg.Status(service.Name) // actualize cache
+		cfg.emit(by, EventModified, service.Name, "changed "+strings.Join(fields, ", "))
+	}
+	if restart {
+		if err := cfg.restart(service.Name, by); err != nil {
+			return change, err
+		}
+		change.Restarted = true
+	}
+	return change, nil
+}
+
+// replaceDefinition of created service and re-renders its unit. Returns changed fields and diff of unit.
+// Unit and definition are rolled back if units can't be reloaded or config can't be saved
+func (cfg *Conf) replaceDefinition(service NewService) ([]string, string, error) {
+	edit, err := cfg.editDefinition(service)
+	if err != nil || edit == nil {
+		return nil, "", err
+	}
+	// reload may be slow, so it is out of lock
+	if reloader, ok := cfg.backend.(UnitReloader); ok {
+		if err := reloader.DaemonReload(!cfg.Global); err != nil {
+			cfg.lock.Lock()
+			defer cfg.lock.Unlock()
+			if current, ok := cfg.Definitions[service.Name]; ok && reflect.DeepEqual(current, edit.service) {
+				edit.rollback(cfg)
+				cfg.saveUnsafe()
+			}
+			return nil, "", err
+		}
+	}
+	return edit.fields, edit.diff, nil
+}
+
+// definitionEdit is an applied change of definition which can be rolled back
+type definitionEdit struct {
+	service  NewService
+	old      NewService
+	unitFile string
+	oldUnit  []byte // nil if unit had no file
+	fields   []string
+	diff     string
+}
+
+// editDefinition replaces definition, installs unit and saves config. Nil edit means nothing is changed
+func (cfg *Conf) editDefinition(service NewService) (*definitionEdit, error) {
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	old, ok := cfg.Definitions[service.Name]
+	if !ok {
+		return nil, ErrNoDefinition
+	}
+	workingDir, err := filepath.Abs(service.WorkingDirectory)
+	if err != nil {
+		return nil, err
+	}
+	service.WorkingDirectory = workingDir
+
+	newUnit, err := renderUnit(service)
+	if err != nil {
+		return nil, err
+	}
+	// unit on disk may be edited by hand, backends with own definitions have no units
+	oldUnit, err := renderUnit(old)
+	if err != nil {
+		return nil, err
+	}
+	edit := &definitionEdit{service: service.clone(), old: old, unitFile: service.Name + ".service"}
+	if _, isInstaller := cfg.backend.(Installer); !isInstaller {
+		if edit.unitFile, err = unitLocation(service.Name, !cfg.Global); err != nil {
+			return nil, err
+		}
+		oldUnit, err = ioutil.ReadFile(edit.unitFile)
+		if os.IsNotExist(err) {
+			oldUnit, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	edit.oldUnit = oldUnit
+	edit.fields = changedFields(old, service)
+	edit.diff = unifiedDiff(edit.unitFile, edit.unitFile, string(oldUnit), string(newUnit))
+	if len(edit.fields) == 0 && edit.diff == "" {
+		return nil, nil
+	}
+
+	if err := cfg.install(service); err != nil {
+		return nil, err
+	}
+	cfg.Definitions[service.Name] = edit.service
+	if err := cfg.saveUnsafe(); err != nil {
+		edit.rollback(cfg)
+		return nil, err
+	}
+	return edit, nil
+}
+
+// rollback unit and definition. Lock of config should be held
+func (edit *definitionEdit) rollback(cfg *Conf) {
+	cfg.Definitions[edit.service.Name] = edit.old
+	if _, isInstaller := cfg.backend.(Installer); isInstaller {
+		cfg.install(edit.old)
+	} else if edit.oldUnit == nil {
+		os.Remove(edit.unitFile)
+	} else {
+		writeFileAtomic(edit.unitFile, edit.oldUnit, 0755)
+	}
+}
+
+// changedFields of definition by JSON names
+func changedFields(old, service NewService) []string {
+	var ans []string
+	if old.Command != service.Command {
+		ans = append(ans, "command")
+	}
+	if old.WorkingDirectory != service.WorkingDirectory {
+		ans = append(ans, "work_dir")
+	}
+	if len(old.Environment)+len(service.Environment) > 0 && !reflect.DeepEqual(old.Environment, service.Environment) {
+		ans = append(ans, "environment")
+	}
+	if old.Restart != service.Restart {
+		ans = append(ans, "restart")
+	}
+	return ans
+}
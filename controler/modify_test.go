@@ -0,0 +1,119 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConf_Modify(t *testing.T) {
+	controller, fake, events := newTestController(t)
+	service := NewService{
+		Name:             "test-gm",
+		Command:          "/usr/bin/nc -v -l 9000",
+		WorkingDirectory: testData,
+	}
+	if err := controller.Create(service); err != nil {
+		t.Fatal("create service:", err)
+	}
+	// enabled and created
+	<-events
+	<-events
+
+	service.Command = "/usr/bin/nc -v -l 9001"
+	service.Environment = map[string]string{"PORT": "9001"}
+	change, err := controller.As("alice", OriginAPI).Modify(service, true)
+	if err != nil {
+		t.Fatal("modify:", err)
+	}
+	for _, expected := range []string{"-ExecStart=/usr/bin/nc -v -l 9000", "+ExecStart=/usr/bin/nc -v -l 9001", "+Environment=PORT=9001"} {
+		if !strings.Contains(change.Diff, expected) {
+			t.Errorf("%q is not in diff:\n%s", expected, change.Diff)
+		}
+	}
+	if !change.Restarted || !fake.running["test-gm"] {
+		t.Error("service is not restarted")
+	}
+	event := <-events
+	if event.Type != EventModified || event.Name != "test-gm" || event.Actor != "alice" || event.Details != "changed command, environment" {
+		t.Error("unexpected event:", event)
+	}
+	if event := <-events; event.Type != EventRestarted {
+		t.Error("unexpected event:", event)
+	}
+	var reloaded bool
+	for _, call := range fake.calls {
+		reloaded = reloaded || call == COMMAND+" "+ModeUser+" "+CmdReload
+	}
+	if !reloaded {
+		t.Error("units are not reloaded:", fake.calls)
+	}
+	home, _ := os.UserHomeDir()
+	unit, _ := ioutil.ReadFile(filepath.Join(home, LocationUser, "test-gm.service"))
+	if !strings.Contains(string(unit), "ExecStart=/usr/bin/nc -v -l 9001") {
+		t.Error("unit is not re-rendered:", string(unit))
+	}
+	if definition, _ := controller.Definition("test-gm"); definition.Command != service.Command {
+		t.Error("definition is not saved:", definition)
+	}
+
+	// the same definition changes nothing
+	change, err = controller.Modify(service, false)
+	if err != nil || change.Diff != "" || change.Restarted {
+		t.Error("unexpected change:", change, err)
+	}
+
+	if err := controller.Attach("nginx"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	if _, err := controller.Modify(NewService{Name: "nginx", Command: "/bin/true"}, false); err != ErrNoDefinition {
+		t.Error("modify of attached service:", err)
+	}
+}
+
+func TestConf_ModifyRollback(t *testing.T) {
+	controller, fake, events := newTestController(t)
+	service := NewService{
+		Name:             "test-gm",
+		Command:          "/usr/bin/nc -v -l 9000",
+		WorkingDirectory: testData,
+	}
+	if err := controller.Create(service); err != nil {
+		t.Fatal("create service:", err)
+	}
+	<-events
+	<-events
+	home, _ := os.UserHomeDir()
+	unitFile := filepath.Join(home, LocationUser, "test-gm.service")
+	// unit edited by hand is restored as is
+	edited := []byte("[Service]\nExecStart=/usr/bin/nc -v -l 9000 # edited\n")
+	if err := ioutil.WriteFile(unitFile, edited, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.lock.Lock()
+	fake.fail[CmdReload] = true
+	fake.lock.Unlock()
+	modified := service
+	modified.Command = "/usr/bin/nc -v -l 9001"
+	if _, err := controller.Modify(modified, false); err == nil {
+		t.Fatal("modify with failed reload succeeded")
+	}
+	if unit, _ := ioutil.ReadFile(unitFile); string(unit) != string(edited) {
+		t.Error("unit is not rolled back:", string(unit))
+	}
+	if definition, _ := controller.Definition("test-gm"); definition.Command != service.Command {
+		t.Error("definition is not rolled back:", definition)
+	}
+	reloaded := NewServiceControllerWithExecutor(controller.(*Conf).location, "", newFakeSystemd())
+	if definition, _ := reloaded.Definition("test-gm"); definition.Command != service.Command {
+		t.Error("saved definition is not rolled back:", definition)
+	}
+	select {
+	case event := <-events:
+		t.Error("unexpected event:", event)
+	default:
+	}
+}
@@ -0,0 +1,9 @@
+package controler
+
+import "syscall"
+
+// processAttributes puts service into own process group to stop children as well
+// and kills it if sukauto dies
+func processAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package controler
+
+import "syscall"
+
+// processAttributes puts service into own process group to stop children as well.
+// Parent death signal is supported on linux only
+func processAttributes() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package controler
+
+import "syscall"
+
+// supervisorSupported checks that processes can be supervised on this platform
+func supervisorSupported() error {
+	return nil
+}
+
+// signalGroup sends signal to process group of leader. Zero signal checks that group is alive
+func signalGroup(leader int, signal syscall.Signal) error {
+	return syscall.Kill(-leader, signal)
+}
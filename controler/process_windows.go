@@ -0,0 +1,20 @@
+package controler
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errNoProcessGroups = errors.New("supervisor backend is not supported on windows: no process groups")
+
+func supervisorSupported() error {
+	return errNoProcessGroups
+}
+
+func processAttributes() *syscall.SysProcAttr {
+	return nil
+}
+
+func signalGroup(leader int, signal syscall.Signal) error {
+	return errNoProcessGroups
+}
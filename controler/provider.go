@@ -0,0 +1,134 @@
+package controler
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Provider authenticates users by external source (htpasswd file, LDAP, ...) instead of config users
+type Provider interface {
+	Login(username string, password string) error
+}
+
+// RoleProvider is a provider which also knows global roles of users
+type RoleProvider interface {
+	Provider
+	// UserRole returns role of user if provider knows roles. Provider with mapping of roles returns RoleNone
+	// for unknown users, so they don't get configured roles
+	UserRole(username string) (Role, bool)
+}
+
+// UserProvider is a provider which can tell that user exists, so certificates and unix peers are mapped to its users
+type UserProvider interface {
+	Provider
+	HasUser(username string) (bool, error)
+}
+
+// StampProvider is a provider which can tell that credentials of user are changed, see Access.UserStamp
+type StampProvider interface {
+	Provider
+	UserStamp(username string) (string, error)
+}
+
+// localUsers is an access which maps certificates and unix peers to user names and keeps roles of users
+type localUsers interface {
+	certificateName(commonName string) string
+	peerName(uid uint32) (string, error)
+	rolesConfigured() bool
+}
+
+// WithProvider returns access which authenticates users by provider. Role from provider (if any) replaces
+// configured roles of user. Without configured roles users of provider are viewers, not admins
+func WithProvider(access Access, provider Provider) Access {
+	return &providerAccess{Access: access, provider: provider}
+}
+
+type providerAccess struct {
+	Access
+	provider Provider
+}
+
+func (pa *providerAccess) Login(username string, password string) error {
+	return pa.provider.Login(username, password)
+}
+
+// UserStamp of provider user. Providers which can't tell it give empty stamp
+func (pa *providerAccess) UserStamp(username string) (string, error) {
+	if sp, ok := pa.provider.(StampProvider); ok {
+		return sp.UserStamp(username)
+	}
+	return "", nil
+}
+
+// CertificateUser maps common name by config to user of provider
+func (pa *providerAccess) CertificateUser(commonName string) (string, error) {
+	local, ok := pa.Access.(localUsers)
+	if !ok {
+		return pa.Access.CertificateUser(commonName)
+	}
+	username := local.certificateName(commonName)
+	return username, pa.checkUser(username, "no user for certificate "+commonName)
+}
+
+// PeerUser maps uid by config to user of provider. Root is always known
+func (pa *providerAccess) PeerUser(uid uint32) (string, error) {
+	local, ok := pa.Access.(localUsers)
+	if !ok {
+		return pa.Access.PeerUser(uid)
+	}
+	username, err := local.peerName(uid)
+	if err != nil || uid == 0 {
+		return username, err
+	}
+	return username, pa.checkUser(username, "no user for uid "+strconv.FormatUint(uint64(uid), 10))
+}
+
+// checkUser exists in provider. Providers which can't tell it accept everyone
+func (pa *providerAccess) checkUser(username string, reason string) error {
+	up, ok := pa.provider.(UserProvider)
+	if !ok {
+		return nil
+	}
+	exists, err := up.HasUser(username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New(reason)
+	}
+	return nil
+}
+
+func (pa *providerAccess) Role(username string, service string) Role {
+	if role, ok := pa.providerRole(username); ok {
+		return role
+	}
+	if pa.defaultRoles() {
+		return RoleViewer
+	}
+	return pa.Access.Role(username, service)
+}
+
+func (pa *providerAccess) GroupRole(username string, group string) Role {
+	if role, ok := pa.providerRole(username); ok {
+		return role
+	}
+	if pa.defaultRoles() {
+		return RoleViewer
+	}
+	return pa.Access.GroupRole(username, group)
+}
+
+// defaultRoles means that neither provider nor config assign roles. Config makes everyone admin then,
+// which is too much for users of external source: admin should be granted explicitly
+func (pa *providerAccess) defaultRoles() bool {
+	local, ok := pa.Access.(localUsers)
+	return ok && !local.rolesConfigured()
+}
+
+func (pa *providerAccess) providerRole(username string) (Role, bool) {
+	if rp, ok := pa.provider.(RoleProvider); ok {
+		return rp.UserRole(username)
+	}
+	return RoleNone, false
+}
@@ -0,0 +1,102 @@
+package controler
+
+import (
+	"fmt"
+)
+
+// Role of user. Each role includes permissions of previous ones
+type Role int
+
+const (
+	RoleNone Role = iota
+	// read statuses, logs and events
+	RoleViewer
+	// start, stop, restart, update, enable and disable services
+	RoleOperator
+	// create, attach and forget services, manage groups, read audit log
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:     "none",
+	RoleViewer:   "viewer",
+	RoleOperator: "operator",
+	RoleAdmin:    "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(data []byte) error {
+	role, err := ParseRole(string(data))
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// UserRole is a global role of user and optional roles for groups.
+// Group role is applied to all members of the group
+type UserRole struct {
+	Role   Role            `json:"role"`
+	Groups map[string]Role `json:"groups,omitempty"`
+}
+
+// Role of user for service (empty name means global role). Without configured roles everyone is admin,
+// otherwise user without explicit role is a viewer
+func (cfg *Conf) Role(username string, service string) Role {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	if len(cfg.Roles) == 0 {
+		return RoleAdmin
+	}
+	binding := cfg.Roles[username]
+	role := binding.Role
+	if role < RoleViewer {
+		role = RoleViewer
+	}
+	if service == "" {
+		return role
+	}
+	for group, groupRole := range binding.Groups {
+		if groupRole > role && containsString(cfg.GroupsList[group], service) {
+			role = groupRole
+		}
+	}
+	return role
+}
+
+func (cfg *Conf) rolesConfigured() bool {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	return len(cfg.Roles) != 0
+}
+
+// GroupRole is a role of user for group itself (global role or role for the group)
+func (cfg *Conf) GroupRole(username string, group string) Role {
+	role := cfg.Role(username, "")
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	if groupRole, ok := cfg.Roles[username].Groups[group]; ok && groupRole > role {
+		role = groupRole
+	}
+	return role
+}
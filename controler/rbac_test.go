@@ -0,0 +1,49 @@
+package controler
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConf_Role(t *testing.T) {
+	var cfg Conf
+	if role := cfg.Role("anyone", "web"); role != RoleAdmin {
+		t.Error("without roles everyone should be admin, got", role)
+	}
+
+	err := json.Unmarshal([]byte(`{
+		"groups": {"backend": ["api", "worker"], "frontend": ["web"]},
+		"roles": {
+			"alice": {"role": "admin"},
+			"bob": {"role": "viewer", "groups": {"backend": "operator"}},
+			"carol": {"role": "operator", "groups": {"frontend": "viewer"}}
+		}
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []struct {
+		user     string
+		service  string
+		expected Role
+	}{
+		{"alice", "", RoleAdmin},
+		{"alice", "web", RoleAdmin},
+		{"bob", "", RoleViewer},
+		{"bob", "api", RoleOperator},
+		{"bob", "web", RoleViewer},
+		{"carol", "web", RoleOperator}, // group role never lowers global one
+		{"dave", "api", RoleViewer},
+	} {
+		if role := cfg.Role(check.user, check.service); role != check.expected {
+			t.Error(check.user, check.service, "expected", check.expected, "got", role)
+		}
+	}
+	if role := cfg.GroupRole("bob", "backend"); role != RoleOperator {
+		t.Error("unexpected group role:", role)
+	}
+
+	if err := json.Unmarshal([]byte(`{"roles": {"eve": {"role": "root"}}}`), &cfg); err == nil {
+		t.Error("unknown role should not be parsed")
+	}
+}
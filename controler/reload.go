@@ -0,0 +1,197 @@
+package controler
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reloader of config file
+type Reloader interface {
+	// Reload config from file. Invalid config is rejected and current one is kept
+	Reload() error
+	// Watch config file and reload it on change. Blocks forever
+	Watch(interval time.Duration)
+}
+
+// configFile tracks modification time of config file to tell external changes from own writes
+type configFile struct {
+	lock    sync.Mutex
+	modTime time.Time
+}
+
+// seen remembers current modification time of file
+func (cf *configFile) seen(location string) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return
+	}
+	cf.lock.Lock()
+	cf.modTime = info.ModTime()
+	cf.lock.Unlock()
+}
+
+// changed checks that file was modified since it was seen last time
+func (cf *configFile) changed(location string) bool {
+	info, err := os.Stat(location)
+	if err != nil {
+		return false
+	}
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+	return !info.ModTime().Equal(cf.modTime)
+}
+
+func (cfg *Conf) Reload() error {
+	return cfg.reload(Actor{Origin: OriginConfig}, "config file changed")
+}
+
+// reload config from file and emit events about added and removed services
+func (cfg *Conf) reload(by Actor, details string) error {
+	cfg.file.seen(cfg.location)
+	jFile, err := ioutil.ReadFile(cfg.location)
+	if err != nil {
+		return err
+	}
+	warnComments(cfg.location, jFile)
+	if jFile, err = formatOf(cfg.location).toJSON(jFile); err != nil {
+		return err
+	}
+	var data Conf
+	upgraded, err := decodeConfig(jFile, &data)
+	if err != nil {
+		return err
+	}
+	if err := data.validate(); err != nil {
+		return err
+	}
+	hashed, err := data.hashPasswords()
+	if err != nil {
+		return err
+	}
+
+	cfg.lock.Lock()
+	previous := cfg.Services
+	// all persisted fields
+	cfg.Version = data.Version
+	cfg.Services = data.Services
+	cfg.Definitions = data.Definitions
+	cfg.GroupsList = data.GroupsList
+	cfg.Global = data.Global
+	cfg.Users = data.Users
+	cfg.Roles = data.Roles
+	cfg.Certificates = data.Certificates
+	cfg.Peers = data.Peers
+	cfg.Tokens = data.Tokens
+	if upgraded || hashed {
+		if err = cfg.saveUnsafe(); err == ErrTOMLComments {
+			err = nil
+		}
+	}
+	cfg.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range data.Services {
+		if !containsString(previous, name) {
+			cfg.Status(name) // actualize cache
+			cfg.emit(by, EventCreated, name, details)
+		}
+	}
+	for _, name := range previous {
+		if !containsString(data.Services, name) {
+			cfg.cache.remove(name)
+			cfg.emit(by, EventRemoved, name, details)
+		}
+	}
+	return nil
+}
+
+func (cfg *Conf) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !cfg.file.changed(cfg.location) {
+			continue
+		}
+		if err := cfg.Reload(); err != nil {
+			fmt.Println("[ERROR]: Reload config:", err)
+			continue
+		}
+		fmt.Println("[MONITOR]: Config reloaded")
+	}
+}
+
+// validate config loaded from file
+func (cfg *Conf) validate() error {
+	if problems := cfg.problems(); len(problems) > 0 {
+		return errors.New(problems[0])
+	}
+	return nil
+}
+
+// problems of config structure
+func (cfg *Conf) problems() []string {
+	var ans []string
+	services := make(map[string]bool)
+	for _, name := range cfg.Services {
+		if strings.TrimSpace(name) == "" {
+			ans = append(ans, "empty service name")
+			continue
+		}
+		if services[name] {
+			ans = append(ans, "duplicated service "+name)
+		}
+		services[name] = true
+	}
+	for _, group := range sortedGroups(cfg.GroupsList) {
+		for _, name := range cfg.GroupsList[group] {
+			if !services[name] {
+				ans = append(ans, fmt.Sprintf("group %s refers to unknown service %s", group, name))
+			}
+		}
+	}
+	for _, name := range sortedDefinitions(cfg.Definitions) {
+		if !services[name] {
+			ans = append(ans, "definition of unknown service "+name)
+		} else if cfg.Definitions[name].Name != name {
+			ans = append(ans, fmt.Sprintf("definition of service %s has name %s", name, cfg.Definitions[name].Name))
+		}
+	}
+	tokens := make(map[string]bool)
+	for _, token := range cfg.Tokens {
+		if token.Name == "" || token.Hash == "" {
+			ans = append(ans, "token without name or hash")
+			continue
+		}
+		if tokens[token.Name] {
+			ans = append(ans, "duplicated token "+token.Name)
+		}
+		tokens[token.Name] = true
+	}
+	return ans
+}
+
+func sortedDefinitions(definitions map[string]NewService) []string {
+	ans := make([]string, 0, len(definitions))
+	for name := range definitions {
+		ans = append(ans, name)
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+func sortedGroups(groups map[string][]string) []string {
+	ans := make([]string, 0, len(groups))
+	for name := range groups {
+		ans = append(ans, name)
+	}
+	sort.Strings(ans)
+	return ans
+}
@@ -0,0 +1,81 @@
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestConf_Reload(t *testing.T) {
+	controller, _, events := newTestController(t)
+	if err := controller.Attach("web"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	<-events
+	cfg := controller.(*Conf)
+
+	// hand edit: replace service and add a group
+	edited := `{"services": ["web", "db"], "groups": {"backend": ["db"]}, "users": {"alice": "secret"}}`
+	if err := ioutil.WriteFile(cfg.location, []byte(edited), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Reload(); err != nil {
+		t.Fatal("reload:", err)
+	}
+	if event := <-events; event.Type != EventCreated || event.Name != "db" || event.Origin != OriginConfig {
+		t.Error("unexpected event:", event)
+	}
+	if groups := controller.Groups(); len(groups) != 1 || groups[0] != "backend" {
+		t.Error("unexpected groups:", groups)
+	}
+	if err := controller.Login("alice", "secret"); err != nil {
+		t.Error("login of reloaded user:", err)
+	}
+	if !isHashed(cfg.Users["alice"]) {
+		t.Error("reloaded password is not hashed")
+	}
+
+	// invalid config is rejected
+	invalid := `{"services": ["web"], "groups": {"backend": ["db"]}}`
+	if err := ioutil.WriteFile(cfg.location, []byte(invalid), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Reload(); err == nil {
+		t.Error("invalid config accepted")
+	}
+	if len(cfg.Services) != 2 {
+		t.Error("config changed by invalid file:", cfg.Services)
+	}
+
+	valid := `{"services": ["web"]}`
+	if err := ioutil.WriteFile(cfg.location, []byte(valid), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Reload(); err != nil {
+		t.Fatal("reload:", err)
+	}
+	if event := <-events; event.Type != EventRemoved || event.Name != "db" {
+		t.Error("unexpected event:", event)
+	}
+	select {
+	case event := <-events:
+		t.Error("unexpected event:", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	controller, _, _ := newTestController(t)
+	cfg := controller.(*Conf)
+	if cfg.file.changed(cfg.location) {
+		t.Error("own write detected as change")
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cfg.location, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.file.changed(cfg.location) {
+		t.Error("external change is not detected")
+	}
+}
@@ -0,0 +1,176 @@
+package controler
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveDir is a directory beside config file for archives of working directories of removed services
+const ArchiveDir = "archive"
+
+var ErrNotCreated = errors.New("service was attached, not created by sukauto: force is required to remove it")
+
+// RemoveOptions of service uninstall
+type RemoveOptions struct {
+	Archive bool // archive working directory before removal (directory itself is kept)
+	Force   bool // forget attached service (its unit is kept) and ignore failures of stop and disable
+}
+
+func (cfg *Conf) remove(name string, options RemoveOptions, by Actor) (string, error) {
+	cfg.lock.RLock()
+	exists := cfg.isServiceExists(name)
+	definition, created := cfg.Definitions[name]
+	cfg.lock.RUnlock()
+	if !exists {
+		return "", errors.New("unknown service " + name)
+	}
+	if !created && !options.Force {
+		return "", ErrNotCreated
+	}
+	if created {
+		if err := cfg.canUninstall(); err != nil {
+			return "", err
+		}
+	}
+	user := !cfg.Global
+	workDir := definition.WorkingDirectory
+	if !created {
+		workDir = workingDirectory(cfg.backend, name, user)
+	}
+
+	if err := cfg.backend.Control(name, STOP, user); err != nil && !options.Force {
+		return "", err
+	}
+	var archive string
+	if options.Archive && workDir != "" {
+		archive = filepath.Join(filepath.Dir(cfg.location), ArchiveDir, name+"-"+time.Now().UTC().Format("20060102T150405Z")+".tar.gz")
+		if err := archiveDirectory(workDir, archive); err != nil {
+			return "", fmt.Errorf("archive %s: %v", workDir, err)
+		}
+	}
+	if err := cfg.backend.Control(name, CmdDisable, user); err != nil && !options.Force {
+		return archive, err
+	}
+	// unit of attached service is written by admin, so it is only forgotten
+	if created {
+		if err := cfg.uninstall(name, user); err != nil {
+			return archive, err
+		}
+	}
+
+	cfg.lock.Lock()
+	err := cfg.dropUnsafe(name)
+	cfg.lock.Unlock()
+	if err != nil {
+		return archive, err
+	}
+	details := "uninstalled"
+	if !created {
+		details = "stopped, disabled and forgotten"
+	}
+	if archive != "" {
+		details += ", working directory archived to " + archive
+	}
+	cfg.emit(by, EventRemoved, name, details)
+	return archive, nil
+}
+
+// canUninstall checks that backend can remove definitions it keeps
+func (cfg *Conf) canUninstall() error {
+	_, installer := cfg.backend.(Installer)
+	if _, uninstaller := cfg.backend.(Uninstaller); installer && !uninstaller {
+		return errors.New("backend keeps service definitions but can not remove them")
+	}
+	return nil
+}
+
+// uninstall service definition from backend or delete unit file rendered by sukauto from stored definition
+func (cfg *Conf) uninstall(name string, user bool) error {
+	if err := cfg.canUninstall(); err != nil {
+		return err
+	}
+	if uninstaller, ok := cfg.backend.(Uninstaller); ok {
+		return uninstaller.Uninstall(name, user)
+	}
+	unitFile, err := unitLocation(name, user)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(unitFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if reloader, ok := cfg.backend.(UnitReloader); ok {
+		return reloader.DaemonReload(user)
+	}
+	return nil
+}
+
+// archiveDirectory packs content of directory to tar.gz file
+func archiveDirectory(dir string, location string) error {
+	if err := os.MkdirAll(filepath.Dir(location), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(location, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zipper := gzip.NewWriter(f)
+	archive := tar.NewWriter(zipper)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			// sockets and other special files
+			return nil
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(archive, src)
+		return err
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if err == nil {
+		err = zipper.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		os.Remove(location)
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package controler
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConf_Remove(t *testing.T) {
+	controller, fake, events := newTestController(t)
+	home, _ := os.UserHomeDir()
+	workDir := filepath.Join(home, "app")
+	if err := os.MkdirAll(filepath.Join(workDir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(workDir, "data", "state.db"), []byte("state"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Create(NewService{Name: "app", Command: "/bin/app", WorkingDirectory: workDir}); err != nil {
+		t.Fatal("create:", err)
+	}
+	if err := controller.Group("backend"); err != nil {
+		t.Fatal("group:", err)
+	}
+	if err := controller.Join("backend", "app"); err != nil {
+		t.Fatal("join:", err)
+	}
+	if err := controller.Run("app"); err != nil {
+		t.Fatal("run:", err)
+	}
+	// enabled, created, joined and started
+	for i := 0; i < 4; i++ {
+		<-events
+	}
+
+	archive, err := controller.Remove("app", RemoveOptions{Archive: true})
+	if err != nil {
+		t.Fatal("remove:", err)
+	}
+	if fake.running["app"] || fake.enabled["app"] {
+		t.Error("service is not stopped and disabled")
+	}
+	if _, err := os.Stat(filepath.Join(home, LocationUser, "app.service")); !os.IsNotExist(err) {
+		t.Error("unit file is not removed:", err)
+	}
+	if members := controller.Members("backend"); len(members) != 0 {
+		t.Error("service is still in group:", members)
+	}
+	if _, err := controller.Definition("app"); err != ErrNoDefinition {
+		t.Error("definition is not removed:", err)
+	}
+	if event := <-events; event.Type != EventRemoved || event.Name != "app" {
+		t.Error("unexpected event:", event)
+	}
+	if names := archiveNames(t, archive); len(names) != 2 || names[0] != "data/" || names[1] != "data/state.db" {
+		t.Error("unexpected archive content:", names)
+	}
+	if _, err := os.Stat(workDir); err != nil {
+		t.Error("working directory is removed:", err)
+	}
+
+	// attached service requires force, its unit is written by admin and kept
+	nginxUnit := filepath.Join(home, LocationUser, "nginx.service")
+	if err := ioutil.WriteFile(nginxUnit, []byte("[Service]\nExecStart=/usr/sbin/nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Attach("nginx"); err != nil {
+		t.Fatal("attach:", err)
+	}
+	if err := controller.Run("nginx"); err != nil {
+		t.Fatal("run:", err)
+	}
+	if _, err := controller.Remove("nginx", RemoveOptions{}); err != ErrNotCreated {
+		t.Error("remove of attached service:", err)
+	}
+	if _, err := controller.Remove("nginx", RemoveOptions{Force: true}); err != nil {
+		t.Error("forced remove of attached service:", err)
+	}
+	if _, err := os.Stat(nginxUnit); err != nil {
+		t.Error("unit of attached service is removed:", err)
+	}
+	if fake.enabled["nginx"] || fake.running["nginx"] {
+		t.Error("attached service is not stopped and disabled")
+	}
+	if _, err := controller.Remove("nginx", RemoveOptions{Force: true}); err == nil {
+		t.Error("remove of unknown service")
+	}
+}
+
+func archiveNames(t *testing.T, location string) []string {
+	f, err := os.Open(location)
+	if err != nil {
+		t.Fatal("open archive:", err)
+	}
+	defer f.Close()
+	zipped, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(zipped)
+	var names []string
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	return names
+}
+
+// installOnlyBackend keeps definitions but can't remove them
+type installOnlyBackend struct {
+	Backend
+}
+
+func (installOnlyBackend) Install(service NewService, user bool) error { return nil }
+
+func TestConf_RemoveWithoutUninstaller(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "config.json")
+	config := `{"services": ["app"], "definitions": {"app": {"name": "app", "command": "/bin/app", "work_dir": "/srv/app"}}}`
+	if err := ioutil.WriteFile(location, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fake := newFakeSystemd()
+	fake.running["app"] = true
+	controller := NewServiceControllerWithBackend(location, "", installOnlyBackend{NewSystemctlBackend(fake)})
+	if _, err := controller.Remove("app", RemoveOptions{Force: true}); err == nil {
+		t.Error("service is removed by backend without uninstaller")
+	}
+	if !fake.running["app"] {
+		t.Error("service is stopped before failure")
+	}
+	if names := controller.(*Conf).serviceNames(); len(names) != 1 {
+		t.Error("service is forgotten:", names)
+	}
+}
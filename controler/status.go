@@ -0,0 +1,82 @@
+package controler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd prints timestamps like "Sun 2019-06-23 12:00:00 UTC"
+const systemdTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// newServiceStatus builds status from properties of service (see StatusFields)
+func newServiceStatus(name string, props map[string]string) ServiceStatus {
+	status := ServiceStatus{
+		Name:          name,
+		Status:        props[FieldStatus],
+		ActiveState:   props[FieldActiveState],
+		LoadState:     props[FieldLoadState],
+		UnitFileState: props[FieldUnitFileState],
+		MainPID:       int(parseUint(props[FieldMainPID])),
+		Restarts:      int(parseUint(props[FieldRestarts])),
+		Memory:        parseUint(props[FieldMemory]),
+		CPU:           parseUint(props[FieldCPU]),
+	}
+	status.ExitCode, _ = strconv.Atoi(props[FieldExitStatus])
+	if started, ok := parseTimestamp(props[FieldStartTimestamp]); ok {
+		status.StartedAt = &started
+		if status.Status == StateRunning {
+			status.Uptime = int64(time.Since(started) / time.Second)
+		}
+	}
+	return status
+}
+
+// parseUint parses numeric property. Unset values ("[not set]", "infinity" or max uint64) are zero
+func parseUint(value string) uint64 {
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || v == math.MaxUint64 {
+		return 0
+	}
+	return v
+}
+
+// parseTimestamp supports systemctl text format, @unix seconds and microseconds since epoch (D-Bus)
+func parseTimestamp(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "n/a" || value == "0" {
+		return time.Time{}, false
+	}
+	if strings.HasPrefix(value, "@") {
+		sec, err := strconv.ParseInt(value[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(sec, 0), true
+	}
+	if usec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, usec*int64(time.Microsecond)), true
+	}
+	t, err := time.ParseInLocation(systemdTimestampLayout, value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// activeState derives systemd active state from sub-state for built-in backends
+func activeState(subState string) string {
+	switch subState {
+	case StateRunning:
+		return "active"
+	case StateAutoRestart:
+		return "activating"
+	case StateFailed:
+		return "failed"
+	case StateDead:
+		return "inactive"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,39 @@
+package controler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewServiceStatus(t *testing.T) {
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	props := parseProperties(`SubState=running
+ActiveState=active
+LoadState=loaded
+UnitFileState=enabled
+MainPID=1234
+ExecMainStartTimestamp=` + started.Format(systemdTimestampLayout) + `
+NRestarts=3
+ExecMainStatus=0
+MemoryCurrent=10485760
+CPUUsageNSec=18446744073709551615
+`)
+	status := newServiceStatus("web", props)
+	if status.Status != StateRunning || status.ActiveState != "active" || status.LoadState != "loaded" || status.UnitFileState != "enabled" {
+		t.Error("unexpected states:", status)
+	}
+	if status.MainPID != 1234 || status.Restarts != 3 || status.ExitCode != 0 || status.Memory != 10485760 || status.CPU != 0 {
+		t.Error("unexpected counters:", status)
+	}
+	if status.StartedAt == nil || !status.StartedAt.Equal(started) {
+		t.Error("unexpected start time:", status.StartedAt)
+	}
+	if status.Uptime < 3600 || status.Uptime > 3660 {
+		t.Error("unexpected uptime:", status.Uptime)
+	}
+
+	status = newServiceStatus("web", map[string]string{FieldStatus: StateDead, FieldStartTimestamp: "n/a", FieldMemory: "[not set]"})
+	if status.StartedAt != nil || status.Uptime != 0 || status.Memory != 0 {
+		t.Error("unexpected status of dead service:", status)
+	}
+}
@@ -0,0 +1,417 @@
+package controler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SupervisorStateFile = "supervisor.json" // located beside config file
+	RestartDelay        = 5 * time.Second
+	StopTimeout         = 10 * time.Second
+)
+
+// Supervisor is a backend for hosts without systemd: it spawns services processes by itself,
+// restarts them by policy and keeps their output in memory. Definitions and desired state of services are
+// persisted in state file, so after restart of sukauto enabled and previously running services are started again
+type Supervisor struct {
+	location     string
+	restartDelay time.Duration
+	stopTimeout  time.Duration
+	lock         sync.Mutex
+	services     map[string]*supervised
+}
+
+var errStopped = errors.New("stopped")
+
+type supervised struct {
+	Service NewService `json:"service"`
+	Enabled bool       `json:"enabled"`
+	Running bool       `json:"running"`         // desired state
+	Group   int        `json:"group,omitempty"` // process group of running process, killed on startup if left alive
+	// runtime state, guarded by own lock (the rest is guarded by supervisor lock)
+	lock     sync.Mutex
+	state    string
+	pid      int
+	restarts int
+	exitCode int
+	started  time.Time
+	stop     chan struct{}
+	done     chan struct{}
+	logs     *ringBuffer
+}
+
+// NewSupervisor loads state of supervised services and starts enabled or previously running ones
+func NewSupervisor(location string) (*Supervisor, error) {
+	if err := supervisorSupported(); err != nil {
+		return nil, err
+	}
+	sv := &Supervisor{
+		location:     location,
+		restartDelay: RestartDelay,
+		stopTimeout:  StopTimeout,
+		services:     make(map[string]*supervised),
+	}
+	data, err := ioutil.ReadFile(location)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &sv.services)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, srv := range sv.services {
+		srv.state = StateDead
+		srv.logs = newRingBuffer(LogLimit)
+		if srv.Group != 0 {
+			// left by crashed sukauto: stop it instead of running duplicate
+			killGroup(srv.Group, sv.stopTimeout)
+			srv.Group = 0
+		}
+	}
+	for _, srv := range sv.services {
+		if srv.Enabled || srv.Running {
+			sv.startUnsafe(srv)
+		}
+	}
+	return sv, nil
+}
+
+func (sv *Supervisor) Install(service NewService, user bool) error {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	if old, ok := sv.services[service.Name]; ok {
+		old.Service = service
+	} else {
+		sv.services[service.Name] = &supervised{
+			Service: service,
+			state:   StateDead,
+			logs:    newRingBuffer(LogLimit),
+		}
+	}
+	return sv.saveUnsafe()
+}
+
+func (sv *Supervisor) Uninstall(name string, user bool) error {
+	sv.lock.Lock()
+	srv, ok := sv.services[name]
+	if !ok {
+		sv.lock.Unlock()
+		return errors.New("unknown service " + name)
+	}
+	stopped := srv.terminate()
+	delete(sv.services, name)
+	err := sv.saveUnsafe()
+	sv.lock.Unlock()
+	// process exit is awaited without lock to not block other services
+	<-stopped
+	return err
+}
+
+func (sv *Supervisor) Control(name string, operation string, user bool) error {
+	sv.lock.Lock()
+	srv, ok := sv.services[name]
+	if !ok {
+		sv.lock.Unlock()
+		return errors.New("unknown service " + name)
+	}
+	stopped := closedChan
+	switch operation {
+	case RUN:
+		sv.startUnsafe(srv)
+	case STOP:
+		stopped = srv.terminate()
+	case RESTART:
+		stopped = srv.terminate()
+		srv.Running = true
+	case CmdEnable:
+		srv.Enabled = true
+	case CmdDisable:
+		srv.Enabled = false
+	default:
+		sv.lock.Unlock()
+		return errors.New("unsupported operation " + operation)
+	}
+	err := sv.saveUnsafe()
+	sv.lock.Unlock()
+	// process exit is awaited without lock to not block other services
+	<-stopped
+	if operation == RESTART && err == nil {
+		sv.lock.Lock()
+		defer sv.lock.Unlock()
+		if sv.services[name] == srv && srv.Running {
+			sv.startUnsafe(srv)
+		}
+	}
+	return err
+}
+
+func (sv *Supervisor) Properties(name string, fields []string, user bool) (map[string]string, error) {
+	sv.lock.Lock()
+	defer sv.lock.Unlock()
+	srv, ok := sv.services[name]
+	if !ok {
+		return nil, errors.New("unknown service " + name)
+	}
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	unitFileState := "disabled"
+	if srv.Enabled {
+		unitFileState = "enabled"
+	}
+	started := ""
+	if !srv.started.IsZero() {
+		started = "@" + strconv.FormatInt(srv.started.Unix(), 10)
+	}
+	all := map[string]string{
+		FieldStatus:         srv.state,
+		FieldActiveState:    activeState(srv.state),
+		FieldLoadState:      "loaded",
+		FieldStartTimestamp: started,
+		WORKDIR:             srv.Service.WorkingDirectory,
+		FieldMainPID:        strconv.Itoa(srv.pid),
+		FieldUnitFileState:  unitFileState,
+		FieldRestarts:       strconv.Itoa(srv.restarts),
+		FieldExitStatus:     strconv.Itoa(srv.exitCode),
+	}
+	ans := make(map[string]string, len(fields))
+	for _, field := range fields {
+		ans[field] = all[field]
+	}
+	return ans, nil
+}
+
+func (sv *Supervisor) Log(name string, user bool) (string, error) {
+	sv.lock.Lock()
+	srv, ok := sv.services[name]
+	sv.lock.Unlock()
+	if !ok {
+		return "", errors.New("unknown service " + name)
+	}
+	return strings.TrimSpace(srv.logs.String()), nil
+}
+
+// startUnsafe starts supervising loop which tracks process group of the service in the state file
+func (sv *Supervisor) startUnsafe(srv *supervised) {
+	srv.start(sv.restartDelay, sv.stopTimeout, func(group int) {
+		sv.lock.Lock()
+		defer sv.lock.Unlock()
+		if sv.services[srv.Service.Name] != srv {
+			return // uninstalled
+		}
+		srv.Group = group
+		if err := sv.saveUnsafe(); err != nil {
+			fmt.Fprintln(srv.logs, "[SUPERVISOR]: save state:", err)
+		}
+	})
+}
+
+func (sv *Supervisor) saveUnsafe() error {
+	data, err := json.MarshalIndent(sv.services, "", "    ")
+	if err != nil {
+		return err
+	}
+	// state is replaced atomically, so crash while saving does not lose processes
+	return writeFileAtomic(sv.location, data, 0600)
+}
+
+var closedChan = func() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// start supervising loop if not yet started
+func (srv *supervised) start(restartDelay, stopTimeout time.Duration, track func(group int)) {
+	srv.Running = true
+	if srv.done != nil {
+		select {
+		case <-srv.done:
+		default:
+			return // still running
+		}
+	}
+	srv.stop = make(chan struct{})
+	srv.done = make(chan struct{})
+	go srv.supervise(srv.Service, restartDelay, stopTimeout, track, srv.stop, srv.done)
+}
+
+// terminate requests stop of supervising loop. Returned channel is closed after process exit
+func (srv *supervised) terminate() <-chan struct{} {
+	srv.Running = false
+	if srv.done == nil {
+		return closedChan
+	}
+	select {
+	case <-srv.stop:
+	default:
+		close(srv.stop)
+	}
+	return srv.done
+}
+
+func (srv *supervised) supervise(service NewService, restartDelay, stopTimeout time.Duration, track func(group int),
+	stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		err := srv.runOnce(service, stopTimeout, track, stop)
+		if err == errStopped {
+			srv.setState(StateDead)
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(srv.logs, "[SUPERVISOR]:", service.Name, "exited:", err)
+		}
+		policy := service.Restart
+		if policy == "" {
+			policy = RestartAlways
+		}
+		if policy == RestartNo || (policy == RestartOnFailure && err == nil) {
+			if err != nil {
+				srv.setState(StateFailed)
+			} else {
+				srv.setState(StateDead)
+			}
+			return
+		}
+		srv.setState(StateAutoRestart)
+		select {
+		case <-time.After(restartDelay):
+			srv.lock.Lock()
+			srv.restarts++
+			srv.lock.Unlock()
+		case <-stop:
+			srv.setState(StateDead)
+			return
+		}
+	}
+}
+
+// runOnce spawns process and waits for its exit or stop request
+func (srv *supervised) runOnce(service NewService, stopTimeout time.Duration, track func(group int), stop <-chan struct{}) error {
+	cmd := exec.Command(SHELL, "-c", service.Command)
+	cmd.Dir = service.WorkingDirectory
+	cmd.Env = os.Environ()
+	for k, v := range service.Environment {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = srv.logs
+	cmd.Stderr = srv.logs
+	cmd.SysProcAttr = processAttributes()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	srv.lock.Lock()
+	srv.state = StateRunning
+	srv.pid = cmd.Process.Pid
+	srv.started = time.Now()
+	srv.lock.Unlock()
+	track(cmd.Process.Pid)
+	defer track(0)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-exited:
+	case <-stop:
+		signalGroup(cmd.Process.Pid, syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+			<-exited
+		}
+		err = errStopped
+	}
+	srv.lock.Lock()
+	srv.pid = 0
+	srv.exitCode = cmd.ProcessState.ExitCode()
+	srv.lock.Unlock()
+	return err
+}
+
+// killGroup terminates process group and kills it if it is still alive after timeout
+func killGroup(group int, timeout time.Duration) {
+	if signalGroup(group, syscall.SIGTERM) != nil {
+		return // already gone
+	}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if signalGroup(group, 0) != nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	signalGroup(group, syscall.SIGKILL)
+}
+
+func (srv *supervised) setState(state string) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	srv.state = state
+}
+
+// ringBuffer keeps last lines of output
+type ringBuffer struct {
+	lock    sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{lines: make([]string, size)}
+}
+
+func (rb *ringBuffer) Write(p []byte) (int, error) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.partial = append(rb.partial, p...)
+	for {
+		i := bytes.IndexByte(rb.partial, '\n')
+		if i < 0 {
+			break
+		}
+		rb.push(string(rb.partial[:i]))
+		rb.partial = rb.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (rb *ringBuffer) push(line string) {
+	rb.lines[rb.next] = line
+	rb.next = (rb.next + 1) % len(rb.lines)
+	if rb.next == 0 {
+		rb.full = true
+	}
+}
+
+func (rb *ringBuffer) String() string {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	var lines []string
+	if rb.full {
+		lines = append(lines, rb.lines[rb.next:]...)
+	}
+	lines = append(lines, rb.lines[:rb.next]...)
+	if len(rb.partial) > 0 {
+		lines = append(lines, string(rb.partial))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,245 @@
+//go:build !windows
+// +build !windows
+
+package controler
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func waitState(t *testing.T, sv *Supervisor, name string, expected string) map[string]string {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		props, err := sv.Properties(name, []string{FieldStatus, FieldMainPID, "NRestarts", "ExecMainStatus"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if props[FieldStatus] == expected {
+			return props
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("service", name, "not in state", expected, "but", props[FieldStatus])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, SupervisorStateFile)
+	sv, err := NewSupervisor(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.restartDelay = 10 * time.Millisecond
+
+	err = sv.Install(NewService{
+		Name:             "sleeper",
+		Command:          "echo $GREETING from $(pwd); sleep 60",
+		WorkingDirectory: dir,
+		Environment:      map[string]string{"GREETING": "hello"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sv.Install(NewService{
+		Name:    "crasher",
+		Command: "exit 3",
+		Restart: RestartOnFailure,
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sv.Control("sleeper", RUN, false); err != nil {
+		t.Fatal(err)
+	}
+	props := waitState(t, sv, "sleeper", StateRunning)
+	if props[FieldMainPID] == "0" {
+		t.Error("no main pid")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		log, _ := sv.Log("sleeper", false)
+		if log == "hello from "+dir {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unexpected log:", log)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := sv.Control("crasher", RUN, false); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		props = waitState(t, sv, "crasher", StateAutoRestart)
+		if props["NRestarts"] != "0" {
+			break
+		}
+	}
+	if props["ExecMainStatus"] != "3" {
+		t.Error("unexpected exit code:", props["ExecMainStatus"])
+	}
+	if err := sv.Control("crasher", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, sv, "crasher", StateDead)
+
+	if err := sv.Control("sleeper", CmdEnable, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Control("sleeper", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, sv, "sleeper", StateDead)
+
+	// enabled services are started after reload
+	restored, err := NewSupervisor(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, restored, "sleeper", StateRunning)
+	waitState(t, restored, "crasher", StateDead)
+	if err := restored.Control("sleeper", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Properties("unknown", []string{FieldStatus}, false); err == nil {
+		t.Error("unknown service should fail")
+	}
+
+	// uninstalled service is forgotten after reload
+	if err := restored.Uninstall("crasher", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restored.Properties("crasher", []string{FieldStatus}, false); err == nil {
+		t.Error("uninstalled service is still known")
+	}
+	again, err := NewSupervisor(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := again.Properties("crasher", []string{FieldStatus}, false); err == nil {
+		t.Error("uninstalled service is restored")
+	}
+	if err := again.Control("sleeper", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRingBuffer(t *testing.T) {
+	rb := newRingBuffer(3)
+	rb.Write([]byte("1\n2\n3"))
+	rb.Write([]byte("\n4\n5"))
+	if v := rb.String(); v != strings.Join([]string{"2", "3", "4", "5"}, "\n") {
+		t.Error("unexpected content:", v)
+	}
+}
+
+func TestSupervisorStopDoesNotBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sv, err := NewSupervisor(filepath.Join(dir, SupervisorStateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sv.stopTimeout = time.Second
+	for _, service := range []NewService{
+		{Name: "stubborn", Command: "trap '' TERM; while true; do sleep 0.05; done"},
+		{Name: "sleeper", Command: "sleep 60"},
+	} {
+		if err := sv.Install(service, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := sv.Control(service.Name, RUN, false); err != nil {
+			t.Fatal(err)
+		}
+		waitState(t, sv, service.Name, StateRunning)
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- sv.Control("stubborn", STOP, false)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	begin := time.Now()
+	if _, err := sv.Properties("sleeper", []string{FieldStatus}, false); err != nil {
+		t.Fatal(err)
+	}
+	if spent := time.Since(begin); spent > 500*time.Millisecond {
+		t.Error("properties blocked by stop for", spent)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, sv, "stubborn", StateDead)
+	if err := sv.Control("sleeper", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSupervisorKillsLeftovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, SupervisorStateFile)
+
+	// process of previous sukauto instance which crashed without stopping it
+	leftover := exec.Command("sleep", "60")
+	leftover.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := leftover.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- leftover.Wait()
+	}()
+	state := `{"sleeper": {"service": {"name": "sleeper", "command": "sleep 60"}, "running": true, "group": ` +
+		strconv.Itoa(leftover.Process.Pid) + `}}`
+	if err := ioutil.WriteFile(stateFile, []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sv, err := NewSupervisor(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		leftover.Process.Kill()
+		t.Fatal("leftover process is not stopped")
+	}
+	props := waitState(t, sv, "sleeper", StateRunning)
+	if props[FieldMainPID] == strconv.Itoa(leftover.Process.Pid) {
+		t.Error("leftover process is reused")
+	}
+	if err := sv.Control("sleeper", STOP, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"group"`) {
+		t.Error("process group of stopped service is kept:", string(data))
+	}
+}
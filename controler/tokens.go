@@ -0,0 +1,171 @@
+package controler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const TokenPrefix = "skt_"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// TokenActions are names of actions checked by API, tokens may be limited by them only
+var TokenActions = []string{
+	"status", "log", "events", "definition",
+	"run", "stop", "restart", "update", "enable", "disable",
+	"create", "attach", "forget", "modify", "reinstall", "remove",
+	"groups", "group", "ungroup", "join", "leave",
+	"audit", "backups", "restore",
+}
+
+// Token is a named API token for automation. Token acts on behalf of owner (with owner's role) and
+// is additionally limited by actions and services. No services and groups mean all services
+type Token struct {
+	Name     string     `json:"name"`
+	Hash     string     `json:"hash,omitempty"` // hex SHA-256 of secret
+	Owner    string     `json:"owner"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Services []string   `json:"services,omitempty"`
+	Groups   []string   `json:"groups,omitempty"`
+	Actions  []string   `json:"actions"`
+}
+
+// TokenManager manages API tokens
+type TokenManager interface {
+	// CreateToken saves token and returns its secret. Secret can't be restored later
+	CreateToken(token Token) (string, error)
+	// ListTokens returns tokens without hashes
+	ListTokens() []Token
+	RevokeToken(name string) error
+	// Authenticate finds valid token by secret
+	Authenticate(secret string) (Token, error)
+	// TokenAllows checks that action on service (empty for global actions) is in scope of token
+	TokenAllows(token Token, action string, service string) bool
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (cfg *Conf) CreateToken(token Token) (string, error) {
+	token.Name = strings.TrimSpace(token.Name)
+	if token.Name == "" {
+		return "", errors.New("empty token name")
+	}
+	if len(token.Actions) == 0 {
+		return "", errors.New("token without actions")
+	}
+	for _, action := range token.Actions {
+		if !containsString(TokenActions, action) {
+			return "", fmt.Errorf("unknown action %q, known actions: %s", action, strings.Join(TokenActions, ", "))
+		}
+	}
+	if token.Expires != nil && token.Expires.Before(time.Now()) {
+		return "", errors.New("token already expired")
+	}
+	data := make([]byte, 24)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	secret := TokenPrefix + base64.RawURLEncoding.EncodeToString(data)
+	token.Hash = hashToken(secret)
+	token.Created = time.Now()
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	for _, t := range cfg.Tokens {
+		if t.Name == token.Name {
+			return "", errors.New("token already exists")
+		}
+	}
+	for _, service := range token.Services {
+		if !cfg.isServiceExists(service) {
+			return "", fmt.Errorf("unknown service %q", service)
+		}
+	}
+	for _, group := range token.Groups {
+		if _, ok := cfg.GroupsList[group]; !ok {
+			return "", fmt.Errorf("unknown group %q", group)
+		}
+	}
+	cfg.Tokens = append(cfg.Tokens, token)
+	if err := cfg.saveUnsafe(); err != nil {
+		cfg.Tokens = cfg.Tokens[:len(cfg.Tokens)-1]
+		return "", err
+	}
+	return secret, nil
+}
+
+func (cfg *Conf) ListTokens() []Token {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	ans := make([]Token, 0, len(cfg.Tokens))
+	for _, token := range cfg.Tokens {
+		token.Hash = ""
+		ans = append(ans, token)
+	}
+	return ans
+}
+
+func (cfg *Conf) RevokeToken(name string) error {
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	for i, token := range cfg.Tokens {
+		if token.Name == name {
+			cfg.Tokens = append(cfg.Tokens[:i], cfg.Tokens[i+1:]...)
+			return cfg.saveUnsafe()
+		}
+	}
+	return errors.New("token not exists")
+}
+
+func (cfg *Conf) Authenticate(secret string) (Token, error) {
+	hash := hashToken(secret)
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	for _, token := range cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) != 1 {
+			continue
+		}
+		if token.Expires != nil && token.Expires.Before(time.Now()) {
+			return Token{}, ErrTokenExpired
+		}
+		token.Hash = ""
+		return token, nil
+	}
+	return Token{}, ErrInvalidToken
+}
+
+func (cfg *Conf) TokenAllows(token Token, action string, service string) bool {
+	if !containsString(token.Actions, action) {
+		return false
+	}
+	if len(token.Services) == 0 && len(token.Groups) == 0 {
+		return true
+	}
+	if service == "" {
+		return false
+	}
+	if containsString(token.Services, service) {
+		return true
+	}
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	for _, group := range token.Groups {
+		if containsString(cfg.GroupsList[group], service) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package controler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConf_Tokens(t *testing.T) {
+	controller, _, _ := newTestController(t)
+	for _, name := range []string{"api", "worker", "web"} {
+		if err := controller.Attach(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := controller.Group("backend"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Join("backend", "worker"); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := controller.CreateToken(Token{Name: "ci", Owner: "root", Services: []string{"api"}, Groups: []string{"backend"}, Actions: []string{"update"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := controller.CreateToken(Token{Name: "ci", Owner: "root", Actions: []string{"update"}}); err == nil {
+		t.Error("duplicated token created")
+	}
+	if _, err := controller.CreateToken(Token{Name: "empty", Owner: "root"}); err == nil {
+		t.Error("token without actions created")
+	}
+	for _, invalid := range []Token{
+		{Name: "typo", Owner: "root", Actions: []string{"updte"}},
+		{Name: "typo", Owner: "root", Services: []string{"apy"}, Actions: []string{"update"}},
+		{Name: "typo", Owner: "root", Groups: []string{"backnd"}, Actions: []string{"update"}},
+	} {
+		if _, err := controller.CreateToken(invalid); err == nil {
+			t.Error("token with unknown scope created:", invalid)
+		}
+	}
+	for _, token := range controller.ListTokens() {
+		if token.Hash != "" {
+			t.Error("hash exposed in list")
+		}
+	}
+
+	token, err := controller.Authenticate(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Name != "ci" || token.Owner != "root" {
+		t.Error("unexpected token:", token)
+	}
+	if _, err := controller.Authenticate(secret + "x"); err != ErrInvalidToken {
+		t.Error("invalid secret accepted:", err)
+	}
+	for _, check := range []struct {
+		action  string
+		service string
+		allowed bool
+	}{
+		{"update", "api", true},
+		{"update", "worker", true},
+		{"update", "web", false},
+		{"stop", "api", false},
+		{"update", "", false},
+	} {
+		if controller.TokenAllows(token, check.action, check.service) != check.allowed {
+			t.Error("unexpected scope check:", check)
+		}
+	}
+
+	expires := time.Now().Add(time.Hour)
+	secret, err = controller.CreateToken(Token{Name: "short", Owner: "root", Expires: &expires, Actions: []string{"status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.(*Conf).Tokens[1].Expires = &time.Time{}
+	if _, err := controller.Authenticate(secret); err != ErrTokenExpired {
+		t.Error("expired token accepted:", err)
+	}
+
+	if err := controller.RevokeToken("ci"); err != nil {
+		t.Fatal(err)
+	}
+	if len(controller.ListTokens()) != 1 {
+		t.Error("token not revoked")
+	}
+}
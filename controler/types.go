@@ -1,8 +1,20 @@
 package controler
 
+import "time"
+
 type ServiceStatus struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	Name          string     `json:"name"`
+	Status        string     `json:"status"` // sub-state: running, dead, ...
+	ActiveState   string     `json:"active_state,omitempty"`
+	LoadState     string     `json:"load_state,omitempty"`
+	UnitFileState string     `json:"unit_file_state,omitempty"` // enabled, disabled, static, ...
+	MainPID       int        `json:"main_pid,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	Uptime        int64      `json:"uptime,omitempty"` // seconds since start of running service
+	Restarts      int        `json:"restarts"`
+	ExitCode      int        `json:"exit_code"`        // last exit code of main process
+	Memory        uint64     `json:"memory,omitempty"` // bytes
+	CPU           uint64     `json:"cpu_ns,omitempty"` // consumed CPU time in nanoseconds
 }
 
 type AllStatuses struct {
@@ -14,6 +26,7 @@ type NewService struct {
 	Command          string            `json:"command" form:"command" bind:"command"`
 	WorkingDirectory string            `json:"work_dir" form:"work_dir" bind:"work_dir"`
 	Environment      map[string]string `json:"environment" form:"environment" bind:"environment"`
+	Restart          string            `json:"restart,omitempty" form:"restart" bind:"restart"` // restart policy: always (default), on-failure, no
 }
 
 type PreparedService struct {
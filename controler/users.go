@@ -0,0 +1,251 @@
+package controler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultUser = "root"
+
+var ErrInvalidCredentials = errors.New("invalid user or password")
+
+// UserManager manages users of config
+type UserManager interface {
+	UserNames() []string
+	// SetPassword creates user or changes password of existing one
+	SetPassword(username string, password string) error
+	RemoveUser(username string) error
+}
+
+// HashPassword returns bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// RandomPassword generates random URL-safe password
+func RandomPassword() (string, error) {
+	data := make([]byte, 12)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func isHashed(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
+
+func (cfg *Conf) Login(username string, password string) (err error) {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	if len(cfg.Users) == 0 {
+		return nil
+	}
+	expected, ok := cfg.Users[username]
+	if !ok {
+		return ErrInvalidCredentials
+	}
+	if !isHashed(expected) {
+		// not migrated yet
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+	if cfg.logins.verified(username, expected, password) {
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(expected), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	cfg.logins.remember(username, expected, password)
+	return nil
+}
+
+func (cfg *Conf) CertificateUser(commonName string) (string, error) {
+	username := cfg.certificateName(commonName)
+	if !cfg.hasUser(username) {
+		return "", errors.New("no user for certificate " + commonName)
+	}
+	return username, nil
+}
+
+// certificateName is a user mapped to common name or the name itself
+func (cfg *Conf) certificateName(commonName string) string {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	if username, ok := cfg.Certificates[commonName]; ok {
+		return username
+	}
+	return commonName
+}
+
+func (cfg *Conf) PeerUser(uid uint32) (string, error) {
+	username, err := cfg.peerName(uid)
+	if err != nil {
+		return "", err
+	}
+	if uid != 0 && !cfg.hasUser(username) {
+		return "", errors.New("no user for uid " + strconv.FormatUint(uint64(uid), 10))
+	}
+	return username, nil
+}
+
+// peerName is a user mapped to uid or name of system account
+func (cfg *Conf) peerName(uid uint32) (string, error) {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	id := strconv.FormatUint(uint64(uid), 10)
+	if username, ok := cfg.Peers[id]; ok {
+		return username, nil
+	}
+	if uid == 0 {
+		return DefaultUser, nil
+	}
+	account, err := user.LookupId(id)
+	if err != nil {
+		return "", err
+	}
+	return account.Username, nil
+}
+
+// hasUser in config. Without users everyone is known
+func (cfg *Conf) hasUser(username string) bool {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	_, exists := cfg.Users[username]
+	return exists || len(cfg.Users) == 0
+}
+
+// UserStamp of config user. Without users everyone is authenticated and stamp is empty
+func (cfg *Conf) UserStamp(username string) (string, error) {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	if len(cfg.Users) == 0 {
+		return "", nil
+	}
+	hash, ok := cfg.Users[username]
+	if !ok {
+		return "", errors.New("no user " + username)
+	}
+	return credentialStamp(hash), nil
+}
+
+// credentialStamp is a short digest of password hash
+func credentialStamp(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (cfg *Conf) UserNames() []string {
+	cfg.lock.RLock()
+	defer cfg.lock.RUnlock()
+	var ans []string
+	for name := range cfg.Users {
+		ans = append(ans, name)
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+func (cfg *Conf) SetPassword(username string, password string) error {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return errors.New("empty user name")
+	}
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	if cfg.Users == nil {
+		cfg.Users = make(map[string]string)
+	}
+	cfg.Users[username] = hash
+	return cfg.saveUnsafe()
+}
+
+func (cfg *Conf) RemoveUser(username string) error {
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	if _, ok := cfg.Users[username]; !ok {
+		return errors.New("user not exists")
+	}
+	delete(cfg.Users, username)
+	delete(cfg.Roles, username)
+	// tokens act on behalf of owner
+	var tokens []Token
+	for _, token := range cfg.Tokens {
+		if token.Owner != username {
+			tokens = append(tokens, token)
+		}
+	}
+	cfg.Tokens = tokens
+	return cfg.saveUnsafe()
+}
+
+// hashPasswords replaces plaintext passwords by hashes. Returns true if something changed
+func (cfg *Conf) hashPasswords() (bool, error) {
+	var changed bool
+	for username, password := range cfg.Users {
+		if isHashed(password) {
+			continue
+		}
+		hash, err := HashPassword(password)
+		if err != nil {
+			return changed, err
+		}
+		cfg.Users[username] = hash
+		changed = true
+	}
+	return changed, nil
+}
+
+// loginCache keeps digests of verified credentials to avoid bcrypt on each request
+type loginCache struct {
+	lock   sync.Mutex
+	digest map[string][sha256.Size]byte
+}
+
+func (lc *loginCache) verified(username, hash, password string) bool {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	digest, ok := lc.digest[username]
+	if !ok {
+		return false
+	}
+	expected := sha256.Sum256([]byte(hash + ":" + password))
+	return subtle.ConstantTimeCompare(digest[:], expected[:]) == 1
+}
+
+func (lc *loginCache) remember(username, hash, password string) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	if lc.digest == nil {
+		lc.digest = make(map[string][sha256.Size]byte)
+	}
+	lc.digest[username] = sha256.Sum256([]byte(hash + ":" + password))
+}
+
+// LoginFailed emits login failure event on behalf of user. Details describe source of attempt
+func (cfg *Conf) LoginFailed(username string, origin string, details string) {
+	cfg.emit(Actor{Name: username, Origin: origin}, EventLoginFailed, username, details)
+}
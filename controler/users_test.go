@@ -0,0 +1,93 @@
+package controler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConf_Login(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(location, []byte(`{"users": {"alice": "secret"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller := NewServiceControllerWithExecutor(location, "", newFakeSystemd())
+
+	// plaintext passwords are migrated on load
+	var saved Conf
+	data, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !isHashed(saved.Users["alice"]) {
+		t.Error("password not hashed:", saved.Users["alice"])
+	}
+	if err := controller.Login("alice", "secret"); err != nil {
+		t.Error("login with migrated password:", err)
+	}
+	if err := controller.Login("alice", "secret"); err != nil {
+		t.Error("cached login:", err)
+	}
+	if err := controller.Login("alice", "wrong"); err == nil {
+		t.Error("login with wrong password")
+	}
+
+	if err := controller.SetPassword("alice", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.Login("alice", "secret"); err == nil {
+		t.Error("login with old password")
+	}
+	if err := controller.Login("alice", "changed"); err != nil {
+		t.Error("login with new password:", err)
+	}
+	if err := controller.SetPassword("bob", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.RemoveUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if users := controller.UserNames(); len(users) != 1 || users[0] != "bob" {
+		t.Error("unexpected users:", users)
+	}
+	if err := controller.Login("alice", "changed"); err == nil {
+		t.Error("login of removed user")
+	}
+}
+
+func TestConf_CertificateUser(t *testing.T) {
+	cfg := &Conf{
+		Users:        map[string]string{"alice": "hash", "bob": "hash"},
+		Certificates: map[string]string{"ci.example.com": "bob"},
+	}
+	for cn, expected := range map[string]string{"alice": "alice", "ci.example.com": "bob", "mallory": ""} {
+		user, err := cfg.CertificateUser(cn)
+		if user != expected || (expected == "") != (err != nil) {
+			t.Error("unexpected user for", cn, ":", user, err)
+		}
+	}
+}
+
+func TestConf_PeerUser(t *testing.T) {
+	cfg := &Conf{
+		Users: map[string]string{"alice": "hash"},
+		Peers: map[string]string{"1000": "alice", "1001": "mallory"},
+	}
+	for uid, expected := range map[uint32]string{0: DefaultUser, 1000: "alice", 1001: "", 4294967290: ""} {
+		user, err := cfg.PeerUser(uid)
+		if user != expected || (expected == "") != (err != nil) {
+			t.Error("unexpected user for uid", uid, ":", user, err)
+		}
+	}
+}
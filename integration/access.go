@@ -0,0 +1,66 @@
+package integration
+
+import (
+	"errors"
+	"sukauto/controler"
+	"time"
+)
+
+type AccessConfig struct {
+	Provider string     `long:"provider" env:"PROVIDER" description:"Users provider" default:"config" choice:"config" choice:"htpasswd" choice:"ldap"`
+	HTPasswd string     `long:"htpasswd" env:"HTPASSWD" description:"Apache htpasswd file (bcrypt, apr1 or SHA1 hashes) for htpasswd provider"`
+	LDAP     LDAPConfig `group:"ldap" namespace:"ldap" env-namespace:"LDAP"`
+}
+
+type LDAPConfig struct {
+	URL          string            `long:"url" env:"URL" description:"LDAP server URL (ldap://host:389 or ldaps://host:636)"`
+	StartTLS     bool              `long:"start-tls" env:"START_TLS" description:"Use StartTLS"`
+	BindDN       string            `long:"bind-dn" env:"BIND_DN" description:"DN of service account to search users and groups (anonymous if not set)"`
+	BindPassword string            `long:"bind-password" env:"BIND_PASSWORD" description:"Password of service account"`
+	BaseDN       string            `long:"base-dn" env:"BASE_DN" description:"Base DN of search"`
+	UserFilter   string            `long:"user-filter" env:"USER_FILTER" description:"Filter of user, %s is a user name" default:"(uid=%s)"`
+	GroupFilter  string            `long:"group-filter" env:"GROUP_FILTER" description:"Filter of user groups, %s is a user DN" default:"(member=%s)"`
+	GroupAttr    string            `long:"group-attr" env:"GROUP_ATTR" description:"Attribute of group name" default:"cn"`
+	Roles        map[string]string `long:"role" env:"ROLES" env-delim:"," description:"Directory group to role mapping, for example devops:admin"`
+	RoleTTL      time.Duration     `long:"role-ttl" env:"ROLE_TTL" description:"How long role found in directory is cached" default:"1m"`
+}
+
+// Open wraps access by selected provider
+func (ac AccessConfig) Open(access controler.Access) (controler.Access, error) {
+	switch ac.Provider {
+	case "htpasswd":
+		if ac.HTPasswd == "" {
+			return nil, errors.New("htpasswd file is not set")
+		}
+		provider, err := controler.NewHTPasswd(ac.HTPasswd)
+		if err != nil {
+			return nil, err
+		}
+		return controler.WithProvider(access, provider), nil
+	case "ldap":
+		options := controler.LDAPOptions{
+			URL:          ac.LDAP.URL,
+			StartTLS:     ac.LDAP.StartTLS,
+			BindDN:       ac.LDAP.BindDN,
+			BindPassword: ac.LDAP.BindPassword,
+			BaseDN:       ac.LDAP.BaseDN,
+			UserFilter:   ac.LDAP.UserFilter,
+			GroupFilter:  ac.LDAP.GroupFilter,
+			GroupAttr:    ac.LDAP.GroupAttr,
+			Roles:        make(map[string]controler.Role),
+			RoleTTL:      ac.LDAP.RoleTTL,
+		}
+		if options.URL == "" {
+			return nil, errors.New("LDAP URL is not set")
+		}
+		for group, name := range ac.LDAP.Roles {
+			role, err := controler.ParseRole(name)
+			if err != nil {
+				return nil, err
+			}
+			options.Roles[group] = role
+		}
+		return controler.WithProvider(access, controler.NewLDAP(options)), nil
+	}
+	return access, nil
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"sukauto/controler"
+	"time"
+)
+
+type AuditConfig struct {
+	File    string `long:"file" env:"FILE" description:"Audit log file (empty - disabled)" default:"audit.jsonl"`
+	MaxSize int64  `long:"max-size" env:"MAX_SIZE" description:"Max size of audit log file in bytes before rotation" default:"10485760"`
+	Keep    int    `long:"keep" env:"KEEP" description:"Number of rotated audit log files to keep" default:"5"`
+}
+
+// Open audit log or returns nil if audit is disabled
+func (ac AuditConfig) Open() *controler.AuditLog {
+	if ac.File == "" {
+		return nil
+	}
+	return controler.NewAuditLog(ac.File, ac.MaxSize, ac.Keep)
+}
+
+// audited is a middleware which records result of request to audit log. Target is a service name
+// (name or name/service for groups) unless handler sets it explicitly by ContextTarget
+func audited(auditLog *controler.AuditLog, action string) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if auditLog == nil {
+			return
+		}
+		target := gctx.Param("name")
+		if service := gctx.Param("service"); service != "" {
+			target += "/" + service
+		}
+		gctx.Set(ContextTarget, target)
+		gctx.Next()
+		record := controler.AuditRecord{
+			Time:   time.Now(),
+			User:   gctx.GetString(ContextUser),
+			Source: clientSource(gctx),
+			Action: action,
+			Target: gctx.GetString(ContextTarget),
+			Result: controler.AuditOK,
+		}
+		if token, ok := requestToken(gctx); ok {
+			record.Token = token.Name
+		}
+		if gctx.Writer.Status() == http.StatusForbidden {
+			record.Result = controler.AuditDenied
+		} else if gctx.Writer.Status() >= http.StatusBadRequest {
+			record.Result = controler.AuditError
+			record.Error = http.StatusText(gctx.Writer.Status())
+		}
+		if err := gctx.Errors.Last(); err != nil {
+			record.Error = err.Error()
+		}
+		if err := auditLog.Record(record); err != nil {
+			gctx.Error(err)
+		}
+	}
+}
+
+// auditHandler serves audit log query: user, action, target, from and to (RFC3339), offset and limit
+func auditHandler(auditLog *controler.AuditLog) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if auditLog == nil {
+			gctx.AbortWithError(http.StatusNotFound, errors.New("audit log disabled"))
+			return
+		}
+		filter := controler.AuditFilter{
+			User:   gctx.Query("user"),
+			Action: gctx.Query("action"),
+			Target: gctx.Query("target"),
+		}
+		var err error
+		if v := gctx.Query("from"); v != "" {
+			if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+				gctx.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+		}
+		if v := gctx.Query("to"); v != "" {
+			if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+				gctx.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+		}
+		if filter.Offset, err = strconv.Atoi(gctx.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+			gctx.AbortWithError(http.StatusBadRequest, errors.New("invalid offset"))
+			return
+		}
+		if filter.Limit, err = strconv.Atoi(gctx.DefaultQuery("limit", strconv.Itoa(DefaultEventsLimit))); err != nil || filter.Limit < 0 {
+			gctx.AbortWithError(http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		page, err := auditLog.Query(filter)
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.IndentedJSON(http.StatusOK, page)
+	}
+}
@@ -0,0 +1,423 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sukauto/controler"
+	"testing"
+	"time"
+)
+
+func TestRoles(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	for _, check := range []struct {
+		user, path string
+		expected   int
+	}{
+		{"admin", "/monitor/run/db", http.StatusNoContent},
+		{"alice", "/monitor/status", http.StatusOK},
+		{"alice", "/monitor/run/web", http.StatusNoContent}, // operator of frontend group
+		{"alice", "/monitor/run/db", http.StatusForbidden},
+		{"alice", "/monitor/audit", http.StatusForbidden},
+		{"bob", "/monitor/status", http.StatusOK}, // viewer by default
+		{"bob", "/monitor/stop/web", http.StatusForbidden},
+	} {
+		res := ts.serve(basicAuth(httptest.NewRequest(http.MethodGet, check.path, nil), check.user, check.user+"-secret"))
+		if res.Code != check.expected {
+			t.Error(check.user, check.path, "unexpected status:", res.Code, res.Body.String())
+		}
+		if res.Code == http.StatusForbidden {
+			var answer struct {
+				Error string `json:"error"`
+			}
+			decodeJSON(t, res, &answer)
+			if !strings.Contains(answer.Error, "role required") {
+				t.Error("unexpected reason:", answer.Error)
+			}
+		}
+	}
+	record := lastAuditRecord(t, ts)
+	if record.User != "bob" || record.Action != "stop" || record.Result != controler.AuditDenied {
+		t.Error("denied request is not audited:", record)
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	ts := newTestServer(t, `{
+		"services": ["web", "db"],
+		"groups": {"frontend": ["web"]},
+		"users": {"admin": "admin-secret", "alice": "alice-secret"},
+		"roles": {"admin": {"role": "admin"}, "alice": {"role": "viewer", "groups": {"frontend": "admin"}}}
+	}`, GuardConfig{})
+	// group admin can't get role on other service by joining it
+	req := basicAuth(httptest.NewRequest(http.MethodPost, "/monitor/group/frontend/db", nil), "alice", "alice-secret")
+	if res := ts.serve(req); res.Code != http.StatusForbidden {
+		t.Error("group admin joins service without role:", res.Code)
+	}
+	if members := ts.controller.Members("frontend"); len(members) != 1 {
+		t.Error("service is joined:", members)
+	}
+	req = basicAuth(httptest.NewRequest(http.MethodDelete, "/monitor/group/frontend/web", nil), "alice", "alice-secret")
+	if res := ts.serve(req); res.Code != http.StatusNoContent {
+		t.Error("group admin can't remove member:", res.Code, res.Body.String())
+	}
+	req = basicAuth(httptest.NewRequest(http.MethodPost, "/monitor/group/frontend/db", nil), "admin", "admin-secret")
+	if res := ts.serve(req); res.Code != http.StatusNoContent {
+		t.Error("admin can't join service:", res.Code, res.Body.String())
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	secret, err := ts.controller.CreateToken(controler.Token{Name: "ci", Owner: "alice", Services: []string{"web", "db"}, Actions: []string{"restart"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bearer := func(path string, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return ts.serve(req)
+	}
+	if res := bearer("/monitor/restart/web", secret); res.Code != http.StatusNoContent {
+		t.Error("token request failed:", res.Code, res.Body.String())
+	}
+	record := lastAuditRecord(t, ts)
+	if record.User != "alice" || record.Token != "ci" || record.Result != controler.AuditOK {
+		t.Error("unexpected audit of token request:", record)
+	}
+	// token acts with role of owner
+	if res := bearer("/monitor/restart/db", secret); res.Code != http.StatusForbidden {
+		t.Error("token exceeds role of owner:", res.Code)
+	}
+	if res := bearer("/monitor/stop/web", secret); res.Code != http.StatusForbidden {
+		t.Error("action out of token scope:", res.Code)
+	}
+	if res := bearer("/monitor/tokens/", secret); res.Code != http.StatusForbidden {
+		t.Error("token lists tokens:", res.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/monitor/tokens/", strings.NewReader(`{"name": "more", "actions": ["stop"]}`))
+	req.Header.Set("Authorization", "Bearer "+secret)
+	req.Header.Set("Content-Type", "application/json")
+	if res := ts.serve(req); res.Code != http.StatusForbidden {
+		t.Error("token creates tokens:", res.Code)
+	}
+	if res := bearer("/monitor/status", secret+"x"); res.Code != http.StatusUnauthorized {
+		t.Error("invalid token accepted:", res.Code)
+	}
+	req = basicAuth(httptest.NewRequest(http.MethodPost, "/monitor/tokens/", strings.NewReader(`{"name": "typo", "actions": ["updte"]}`)), "alice", "alice-secret")
+	req.Header.Set("Content-Type", "application/json")
+	if res := ts.serve(req); res.Code != http.StatusBadRequest {
+		t.Error("token with unknown action created:", res.Code)
+	}
+}
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCA) client(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSConfig_SelfSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := TLSConfig{SelfSigned: true, Cert: filepath.Join(dir, "cert.pem"), Key: filepath.Join(dir, "key.pem")}
+	server, err := config.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated, err := x509.ParseCertificate(server.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generated.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := generated.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if info, err := os.Stat(config.Key); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("private key is not saved privately:", info, err)
+	}
+	// saved certificate is reused
+	server, err = config.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := x509.ParseCertificate(server.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.SerialNumber.Cmp(generated.SerialNumber) != 0 {
+		t.Error("certificate is generated again")
+	}
+	if _, err := (TLSConfig{ClientCA: filepath.Join(dir, "ca.pem")}).Server(); err == nil {
+		t.Error("client CA without TLS accepted")
+	}
+}
+
+func TestClientCertificates(t *testing.T) {
+	ts := newTestServer(t, `{
+		"services": ["web", "db"],
+		"groups": {"frontend": ["web"]},
+		"users": {"admin": "admin-secret", "alice": "alice-secret"},
+		"roles": {"admin": {"role": "admin"}, "alice": {"role": "viewer", "groups": {"frontend": "operator"}}},
+		"certificates": {"alice-laptop": "alice"}
+	}`, GuardConfig{})
+	ca := newTestCA(t)
+	caFile := filepath.Join(ts.dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := TLSConfig{SelfSigned: true, ClientCA: caFile}.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(ts.handler)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(cert *tls.Certificate, path string) (int, error) {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		if cert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		defer transport.CloseIdleConnections()
+		res, err := (&http.Client{Transport: transport}).Get(server.URL + path)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+	alice := ca.client(t, "alice-laptop")
+	admin := ca.client(t, "admin")
+	unknown := ca.client(t, "mallory")
+	foreign := newTestCA(t).client(t, "admin")
+	for _, check := range []struct {
+		name     string
+		cert     *tls.Certificate
+		path     string
+		expected int
+	}{
+		{"mapped CN", &alice, "/monitor/run/web", http.StatusNoContent},
+		{"role of mapped user", &alice, "/monitor/run/db", http.StatusForbidden},
+		{"CN as user", &admin, "/monitor/run/db", http.StatusNoContent},
+		{"unknown user", &unknown, "/monitor/status", http.StatusUnauthorized},
+		{"no certificate", nil, "/monitor/status", http.StatusUnauthorized},
+	} {
+		code, err := get(check.cert, check.path)
+		if err != nil {
+			t.Error(check.name, err)
+		} else if code != check.expected {
+			t.Error(check.name, "unexpected status:", code)
+		}
+	}
+	if _, err := get(&foreign, "/monitor/status"); err == nil {
+		t.Error("certificate of unknown CA accepted")
+	}
+}
+
+// fakeRoleProvider knows roles of listed users only
+type fakeRoleProvider map[string]controler.Role
+
+func (fp fakeRoleProvider) Login(username string, password string) error {
+	return controler.ErrInvalidCredentials
+}
+
+func (fp fakeRoleProvider) UserRole(username string) (controler.Role, bool) {
+	return fp[username], true
+}
+
+func TestProviderRoles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	location := filepath.Join(dir, "config.json")
+	// no roles in config means everyone is admin
+	if err := ioutil.WriteFile(location, []byte(`{"services": ["web", "db"], "groups": {"frontend": ["web"]}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	controller := controler.NewServiceControllerWithBackend(location, "true", &fakeBackend{})
+	access := controler.WithProvider(controller, fakeRoleProvider{"alice": controler.RoleOperator})
+	ts := newTestServerWithAccess(t, controller, access, GuardConfig{})
+
+	ca := newTestCA(t)
+	caFile := filepath.Join(ts.dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := TLSConfig{SelfSigned: true, ClientCA: caFile}.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(ts.handler)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+	get := func(commonName string, path string) int {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{ca.client(t, commonName)},
+		}}
+		defer transport.CloseIdleConnections()
+		res, err := (&http.Client{Transport: transport}).Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := get("alice", "/monitor/run/web"); code != http.StatusNoContent {
+		t.Error("certificate of provider user:", code)
+	}
+	if code := get("alice", "/monitor/group/frontend"); code != http.StatusOK {
+		t.Error("group role of provider user:", code)
+	}
+	if code := get("mallory", "/monitor/status"); code != http.StatusForbidden {
+		t.Error("certificate of user unknown to provider:", code)
+	}
+
+	bearer := func(owner string, path string) int {
+		secret, err := controller.CreateToken(controler.Token{Name: owner, Owner: owner, Actions: []string{"status", "restart"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return ts.serve(req).Code
+	}
+	if code := bearer("alice", "/monitor/restart/db"); code != http.StatusNoContent {
+		t.Error("token of provider user:", code)
+	}
+	if code := bearer("mallory", "/monitor/status"); code != http.StatusForbidden {
+		t.Error("token of user unknown to provider:", code)
+	}
+}
+
+func TestUnixSocketPeers(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are supported on linux only")
+	}
+	uid := os.Getuid()
+	ts := newTestServer(t, `{
+		"services": ["web", "db"],
+		"groups": {"frontend": ["web"]},
+		"users": {"admin": "admin-secret", "alice": "alice-secret"},
+		"roles": {"admin": {"role": "admin"}, "alice": {"role": "viewer", "groups": {"frontend": "operator"}}},
+		"peers": {"`+strconv.Itoa(uid)+`": "alice"}
+	}`, GuardConfig{AllowIP: []string{"198.51.100.0/24"}})
+	socket := filepath.Join(ts.dir, "sukauto.sock")
+	go (UnixConfig{Socket: socket, Mode: "0600"}).Serve(ts.handler)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("socket is not created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	get := func(path string) int {
+		res, err := client.Get("http://localhost" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	// peers are local and skip IP allowlist
+	if code := get("/monitor/run/web"); code != http.StatusNoContent {
+		t.Error("peer request failed:", code)
+	}
+	record := lastAuditRecord(t, ts)
+	if record.User != "alice" || !strings.HasPrefix(record.Source, "unix:uid="+strconv.Itoa(uid)+",") {
+		t.Error("unexpected audit of peer request:", record)
+	}
+	expected := http.StatusForbidden
+	if uid == 0 {
+		expected = http.StatusNoContent // root is always admin
+	}
+	if code := get("/monitor/run/db"); code != expected {
+		t.Error("unexpected status of run by peer:", code)
+	}
+	// TCP clients are checked by allowlist
+	req := basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), "admin", "admin-secret")
+	if res := ts.serve(req); res.Code != http.StatusForbidden {
+		t.Error("client out of allowlist accepted:", res.Code)
+	}
+}
@@ -3,4 +3,18 @@ package integration
 const (
 	Realm         = "Authorization Required"
 	WWWAuthHeader = "WWW-Authenticate"
+	// gin context key of authenticated user name
+	ContextUser = "user"
+	// gin context key of API token (if request is authenticated by token)
+	ContextToken = "token"
+	// gin context key of web session (if request is authenticated by session cookie)
+	ContextSession = "session"
+	// session cookies and CSRF header
+	SessionCookie = "sukauto_session"
+	CSRFCookie    = "sukauto_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+	// gin context key of operation target for audit
+	ContextTarget = "target"
+	// default page size of events history
+	DefaultEventsLimit = 100
 )
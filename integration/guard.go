@@ -0,0 +1,134 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sukauto/controler"
+	"time"
+)
+
+var errLocked = errors.New("too many failed attempts, try later")
+
+type GuardConfig struct {
+	AllowIP     []string      `long:"allow-ip" env:"ALLOW_IP" env-delim:"," description:"IP addresses or CIDR ranges allowed to reach API (empty - any)"`
+	TrustProxy  bool          `long:"trust-proxy" env:"TRUST_PROXY" description:"Take client IP from X-Forwarded-For and X-Real-Ip headers"`
+	MaxAttempts int           `long:"max-attempts" env:"MAX_ATTEMPTS" description:"Failed login attempts before lockout" default:"5"`
+	Lockout     time.Duration `long:"lockout" env:"LOCKOUT" description:"Initial lockout, doubled on each next failure" default:"1m"`
+	MaxLockout  time.Duration `long:"max-lockout" env:"MAX_LOCKOUT" description:"Max lockout" default:"1h"`
+}
+
+// Guard protects API from brute-force and unknown networks
+type Guard struct {
+	attempts   *controler.LoginGuard
+	allowed    []*net.IPNet
+	trustProxy bool
+}
+
+func (gc GuardConfig) Open() (*Guard, error) {
+	guard := &Guard{
+		attempts:   controler.NewLoginGuard(gc.MaxAttempts, gc.Lockout, gc.MaxLockout),
+		trustProxy: gc.TrustProxy,
+	}
+	for _, item := range gc.AllowIP {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		guard.allowed = append(guard.allowed, network)
+	}
+	return guard, nil
+}
+
+// Attempts tracker of failed logins
+func (g *Guard) Attempts() *controler.LoginGuard {
+	return g.attempts
+}
+
+// Allows checks address against allowlist. Empty allowlist allows everything
+func (g *Guard) Allows(ip net.IP) bool {
+	if len(g.allowed) == 0 {
+		return true
+	}
+	for _, network := range g.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowlist is a middleware which rejects clients out of allowed networks. Unix socket clients are local
+func (g *Guard) allowlist() gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if _, local := requestPeer(gctx); local {
+			return
+		}
+		if !g.Allows(net.ParseIP(gctx.ClientIP())) {
+			forbid(gctx, "address is not allowed")
+		}
+	}
+}
+
+// login checks credentials with lockout by client address and user name. Lockout by user name is not applied
+// to addresses the user logged in from, so nobody can lock the user out by guessing its password.
+// Failures are reported to access
+func (g *Guard) login(gctx *gin.Context, access controler.Access, username, password string) error {
+	ip := gctx.ClientIP()
+	userKey := "user:" + username
+	keys := []string{"ip:" + ip}
+	if !g.attempts.Trusted(userKey, ip) {
+		keys = append(keys, userKey)
+	}
+	if wait := g.attempts.Locked(keys...); wait > 0 {
+		gctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return errLocked
+	}
+	if err := access.Login(username, password); err != nil {
+		failures := g.attempts.Fail(keys...)
+		access.LoginFailed(username, controler.OriginAPI, fmt.Sprintf("from %s, %d failures in a row", ip, failures))
+		return err
+	}
+	g.attempts.Reset(keys...)
+	g.attempts.Trust(userKey, ip)
+	return nil
+}
+
+// authenticate checks API token with lockout by client address
+func (g *Guard) authenticate(gctx *gin.Context, access controler.Access, secret string) (controler.Token, error) {
+	ip := gctx.ClientIP()
+	key := "ip:" + ip
+	if wait := g.attempts.Locked(key); wait > 0 {
+		gctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		return controler.Token{}, errLocked
+	}
+	token, err := access.Authenticate(secret)
+	if err == controler.ErrInvalidToken {
+		failures := g.attempts.Fail(key)
+		access.LoginFailed("token", controler.OriginAPI, fmt.Sprintf("invalid token from %s, %d failures in a row", ip, failures))
+	}
+	return token, err
+}
+
+// statusOf login error
+func statusOf(err error) int {
+	if err == errLocked {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusUnauthorized
+}
@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"golang.org/x/net/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sukauto/controler"
+	"testing"
+	"time"
+)
+
+func TestGuardLockout(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	request := func(ip, password string) int {
+		req := basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), "admin", password)
+		req.RemoteAddr = ip + ":40000"
+		return ts.serve(req).Code
+	}
+	if code := request("192.0.2.1", "admin-secret"); code != http.StatusOK {
+		t.Fatal("admin login failed:", code)
+	}
+	// attacker from other addresses can't lock admin out of the address admin logged in from
+	for i := 0; i < 10; i++ {
+		request("198.51.100.1", "guess")
+		request("198.51.100.2", "guess")
+	}
+	if code := request("198.51.100.1", "admin-secret"); code != http.StatusTooManyRequests {
+		t.Error("attacker address is not locked:", code)
+	}
+	if code := request("203.0.113.1", "admin-secret"); code != http.StatusTooManyRequests {
+		t.Error("user is not locked for unknown addresses:", code)
+	}
+	if code := request("192.0.2.1", "admin-secret"); code != http.StatusOK {
+		t.Error("admin is locked out of own address:", code)
+	}
+}
+
+func TestLoginFailedEventsHidden(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	err := ts.history.Append(controler.SystemEvent{
+		Type:    controler.EventLoginFailed,
+		Name:    "admin",
+		Actor:   "admin",
+		Time:    time.Now(),
+		Origin:  controler.OriginAPI,
+		Details: "from 198.51.100.1, 3 failures in a row",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for user, expected := range map[string]string{"admin": "admin", "bob": HiddenValue} {
+		res := ts.serve(basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/events", nil), user, user+"-secret"))
+		if res.Code != http.StatusOK {
+			t.Fatal(user, "unexpected status:", res.Code, res.Body.String())
+		}
+		var page controler.HistoryPage
+		decodeJSON(t, res, &page)
+		if len(page.Events) != 1 {
+			t.Fatal(user, "unexpected events:", page.Events)
+		}
+		event := page.Events[0]
+		if event.Name != expected || event.Actor != expected || strings.Contains(event.Details, "198.51.100.1") == (expected == HiddenValue) {
+			t.Error(user, "sees unexpected event:", event)
+		}
+	}
+}
+
+func TestLoginFailedEventsHiddenInWebsocket(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	server := httptest.NewServer(ts.handler)
+	defer server.Close()
+	dial := func(user string) *websocket.Conn {
+		config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/monitor/ws", server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Header.Set("Authorization", basicAuth(httptest.NewRequest(http.MethodGet, "/", nil), user, user+"-secret").Header.Get("Authorization"))
+		conn, err := websocket.DialConfig(config)
+		if err != nil {
+			t.Fatal(user, err)
+		}
+		return conn
+	}
+	admin, bob := dial("admin"), dial("bob")
+	defer admin.Close()
+	defer bob.Close()
+	// subscription is asynchronous, so attempts are repeated until event is received
+	receive := func(conn *websocket.Conn) (controler.SystemEvent, error) {
+		var event controler.SystemEvent
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		return event, websocket.JSON.Receive(conn, &event)
+	}
+	var adminEvent, bobEvent controler.SystemEvent
+	for i := 0; i < 3; i++ {
+		ts.serve(basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), "alice", "guess"))
+		var err error
+		if adminEvent, err = receive(admin); err != nil {
+			continue
+		}
+		if bobEvent, err = receive(bob); err == nil {
+			break
+		}
+	}
+	if adminEvent.Type != controler.EventLoginFailed || adminEvent.Name != "alice" {
+		t.Error("unexpected event for admin:", adminEvent)
+	}
+	if bobEvent.Type != controler.EventLoginFailed || bobEvent.Name != HiddenValue || bobEvent.Details != HiddenValue {
+		t.Error("unexpected event for viewer:", bobEvent)
+	}
+}
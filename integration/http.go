@@ -3,6 +3,7 @@ package integration
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/net/websocket"
@@ -12,28 +13,34 @@ import (
 	"strconv"
 	"strings"
 	"sukauto/controler"
+	"time"
 )
 
+// HiddenValue replaces secrets shown to non-admins: values of environment variables in definitions and
+// details of failed logins in events
+const HiddenValue = "<hidden>"
+
 type CorsConfig struct {
 	Allow  bool   `long:"allow" env:"ALLOW" description:"Allow CORS"`
 	Origin string `long:"origin" env:"ORIGIN" description:"CORS origin host" default:"*"`
 }
 
-func NewHTTP(controller controler.ServiceController, access controler.Access, cors CorsConfig, events <-chan controler.SystemEvent) *gin.Engine {
+func NewHTTP(controller controler.ServiceController, access controler.Access, cors CorsConfig, events <-chan controler.SystemEvent, history *controler.History, auditLog *controler.AuditLog, sessions *Sessions, guard *Guard) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.ForwardedByClientIP = guard.trustProxy
 	router.Use(gin.Recovery())
-	subscribe := make(chan *websocket.Conn)
+	subscribe := make(chan subscriber)
 	unsubscribe := make(chan *websocket.Conn)
 	go func() {
-		var subscribers []*websocket.Conn
+		var subscribers []subscriber
 		for {
 			select {
-			case conn := <-subscribe:
-				subscribers = append(subscribers, conn)
+			case s := <-subscribe:
+				subscribers = append(subscribers, s)
 			case conn := <-unsubscribe:
 				for i, s := range subscribers {
-					if s == conn {
+					if s.conn == conn {
 						n := len(subscribers)
 						subscribers[i] = subscribers[n-1]
 						subscribers = subscribers[:n-1]
@@ -42,8 +49,13 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 				}
 			case event := <-events:
 				payload, _ := json.MarshalIndent(event, "", "  ")
+				hidden, _ := json.MarshalIndent(visibleEvent(event, false), "", "  ")
 				for _, s := range subscribers {
-					s.Write(payload)
+					if s.admin {
+						s.conn.Write(payload)
+					} else {
+						s.conn.Write(hidden)
+					}
 				}
 			}
 		}
@@ -57,11 +69,54 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 	})
 	router.StaticFS("/public/", assetFS())
 
+	router.POST("/login", guard.allowlist(), loginHandler(access, sessions, guard))
+	router.POST("/logout", guard.allowlist(), logoutHandler(sessions))
+
 	authOnly := router.Group("/monitor")
-	authOnly.Use(func(gctx *gin.Context) {
+	authOnly.Use(guard.allowlist(), func(gctx *gin.Context) {
 		hRealm := "Basic realm=" + strconv.Quote(Realm)
 		authBase := gctx.Request.Header.Get("Authorization")
+		if peer, ok := requestPeer(gctx); ok {
+			user, err := access.PeerUser(peer.UID)
+			if err != nil {
+				gctx.AbortWithError(http.StatusUnauthorized, err)
+				return
+			}
+			gctx.Set(ContextUser, user)
+			requireViewer(gctx, access)
+			return
+		}
+		if state := gctx.Request.TLS; state != nil && len(state.VerifiedChains) > 0 {
+			user, err := access.CertificateUser(state.PeerCertificates[0].Subject.CommonName)
+			if err != nil {
+				gctx.AbortWithError(http.StatusUnauthorized, err)
+				return
+			}
+			gctx.Set(ContextUser, user)
+			requireViewer(gctx, access)
+			return
+		}
+		if cookie, err := gctx.Cookie(SessionCookie); err == nil && authBase == "" {
+			if s, ok := sessions.Authenticate(cookie, access); ok {
+				gctx.Set(ContextUser, s.User)
+				gctx.Set(ContextSession, s)
+				requireViewer(gctx, access)
+				return
+			}
+		}
 		authScheme := strings.Split(authBase, " ")
+		if authScheme[0] == "Bearer" && len(authScheme) == 2 {
+			token, err := guard.authenticate(gctx, access, authScheme[1])
+			if err != nil {
+				gctx.AbortWithError(statusOf(err), err)
+				return
+			}
+			// token acts on behalf of owner
+			gctx.Set(ContextUser, token.Owner)
+			gctx.Set(ContextToken, token)
+			requireViewer(gctx, access)
+			return
+		}
 		if authScheme[0] != "Basic" || len(authScheme) != 2 {
 			gctx.Header(WWWAuthHeader, hRealm)
 			gctx.AbortWithStatus(http.StatusUnauthorized)
@@ -74,65 +129,92 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 			return
 		}
 		up := strings.SplitN(string(auth), ":", 2)
-		if len(up) == 2 && access.Login(up[0], up[1]) == nil {
-			gctx.Next()
+		if len(up) != 2 {
+			gctx.Header(WWWAuthHeader, hRealm)
+			gctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if err := guard.login(gctx, access, up[0], up[1]); err != nil {
+			if err != errLocked {
+				gctx.Header(WWWAuthHeader, hRealm)
+			}
+			gctx.AbortWithError(statusOf(err), err)
 			return
 		}
-		gctx.Header(WWWAuthHeader, hRealm)
-		gctx.AbortWithStatus(http.StatusUnauthorized)
+		gctx.Set(ContextUser, up[0])
+		requireViewer(gctx, access)
 	})
 
-	authOnly.GET("/", func(gctx *gin.Context) {
+	authOnly.GET("/", authorize(access, "status", controler.RoleViewer), func(gctx *gin.Context) {
+		if isFresh(gctx) {
+			controller.RefreshStatus()
+		}
 		gctx.IndentedJSON(http.StatusOK, controller.Snapshot())
 	})
-	authOnly.GET("/ws", gin.WrapH(websocket.Handler(func(ws *websocket.Conn) {
-		defer ws.Close()
-		subscribe <- ws
-		io.Copy(ioutil.Discard, ws)
-		unsubscribe <- ws
-	})))
-	authOnly.GET("/run/:name", func(gctx *gin.Context) {
+	authOnly.GET("/ws", verifyOrigin(), authorize(access, "status", controler.RoleViewer), func(gctx *gin.Context) {
+		admin := roleOf(gctx, access, "") >= controler.RoleAdmin
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			subscribe <- subscriber{conn: ws, admin: admin}
+			io.Copy(ioutil.Discard, ws)
+			unsubscribe <- ws
+		}).ServeHTTP(gctx.Writer, gctx.Request)
+	})
+	authOnly.GET("/run/:name", audited(auditLog, "run"), verifyCSRF(), authorizeService(access, "run", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Run(name); err != nil {
+		if err := actor(gctx, controller).Run(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/stop/:name", func(gctx *gin.Context) {
+	authOnly.GET("/stop/:name", audited(auditLog, "stop"), verifyCSRF(), authorizeService(access, "stop", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Stop(name); err != nil {
+		if err := actor(gctx, controller).Stop(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/update/:name", func(gctx *gin.Context) {
+	authOnly.GET("/update/:name", audited(auditLog, "update"), verifyCSRF(), authorizeService(access, "update", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Update(name); err != nil {
+		if err := actor(gctx, controller).Update(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/restart/:name", func(gctx *gin.Context) {
+	authOnly.GET("/restart/:name", audited(auditLog, "restart"), verifyCSRF(), authorizeService(access, "restart", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Restart(name); err != nil {
+		if err := actor(gctx, controller).Restart(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/status", func(gctx *gin.Context) {
-		response := controller.RefreshStatus()
+	authOnly.GET("/status", authorize(access, "status", controler.RoleViewer), func(gctx *gin.Context) {
+		var response controler.AllStatuses
+		if isFresh(gctx) {
+			response = controller.RefreshStatus()
+		} else {
+			response = controller.Statuses()
+		}
 		gctx.IndentedJSON(http.StatusOK, response)
 	})
-	authOnly.GET("/status/:name", func(gctx *gin.Context) {
+	authOnly.GET("/status/:name", authorizeService(access, "status", controler.RoleViewer), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		if !isFresh(gctx) {
+			for _, status := range controller.Statuses().Services {
+				if status.Name == name {
+					gctx.IndentedJSON(http.StatusOK, status)
+					return
+				}
+			}
+		}
 		status := controller.Status(name)
 		gctx.IndentedJSON(http.StatusOK, status)
 	})
-	authOnly.Use(gzip.Gzip(gzip.BestCompression)).GET("/log/:name", func(gctx *gin.Context) {
+	authOnly.Use(gzip.Gzip(gzip.BestCompression)).GET("/log/:name", authorizeService(access, "log", controler.RoleViewer), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
 		if log, err := controller.Log(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
@@ -141,51 +223,179 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 			gctx.String(http.StatusOK, log)
 		}
 	})
-	authOnly.GET("/enable/:name", func(gctx *gin.Context) {
+	authOnly.GET("/enable/:name", audited(auditLog, "enable"), verifyCSRF(), authorizeService(access, "enable", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Enable(name); err != nil {
+		if err := actor(gctx, controller).Enable(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/disable/:name", func(gctx *gin.Context) {
+	authOnly.GET("/disable/:name", audited(auditLog, "disable"), verifyCSRF(), authorizeService(access, "disable", controler.RoleOperator), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Disable(name); err != nil {
+		if err := actor(gctx, controller).Disable(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.GET("/forget/:name", func(gctx *gin.Context) {
+	authOnly.GET("/forget/:name", audited(auditLog, "forget"), verifyCSRF(), authorizeService(access, "forget", controler.RoleAdmin), func(gctx *gin.Context) {
 		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
-		if err := controller.Forget(name); err != nil {
+		if err := actor(gctx, controller).Forget(name); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.POST("/create", func(gctx *gin.Context) {
+	authOnly.POST("/create", audited(auditLog, "create"), verifyCSRF(), authorize(access, "create", controler.RoleAdmin), func(gctx *gin.Context) {
 		var newService controler.NewService
 		err := gctx.BindJSON(&newService)
 		if err != nil {
 			gctx.AbortWithError(http.StatusBadRequest, err)
 			return
 		}
-		if err := controller.Create(newService); err != nil {
+		gctx.Set(ContextTarget, newService.Name)
+		if err := actor(gctx, controller).Create(newService); err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
-	authOnly.POST("/attach", func(gctx *gin.Context) {
+	authOnly.POST("/attach", audited(auditLog, "attach"), verifyCSRF(), authorize(access, "attach", controler.RoleAdmin), func(gctx *gin.Context) {
 		var newService controler.PreparedService
 		err := gctx.BindJSON(&newService)
 		if err != nil {
 			gctx.AbortWithError(http.StatusBadRequest, err)
 			return
 		}
-		if err := controller.Attach(newService.Name); err != nil {
+		gctx.Set(ContextTarget, newService.Name)
+		if err := actor(gctx, controller).Attach(newService.Name); err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.AbortWithStatus(http.StatusNoContent)
+	})
+	// --------------- definitions of created services
+	authOnly.GET("/service/:name", authorizeService(access, "definition", controler.RoleOperator), func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		definition, err := controller.Definition(name)
+		if err == controler.ErrNoDefinition {
+			gctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		if roleOf(gctx, access, name) < controler.RoleAdmin {
+			// environment often keeps secrets
+			for key := range definition.Environment {
+				definition.Environment[key] = HiddenValue
+			}
+		}
+		gctx.IndentedJSON(http.StatusOK, definition)
+	})
+	// change definition and re-render unit, ?restart=1 restarts service
+	authOnly.PUT("/service/:name", audited(auditLog, "modify"), verifyCSRF(), authorizeService(access, "modify", controler.RoleAdmin), func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		var service controler.NewService
+		if err := gctx.BindJSON(&service); err != nil {
+			gctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if service.Name != "" && service.Name != name {
+			gctx.AbortWithError(http.StatusBadRequest, errors.New("service can not be renamed"))
+			return
+		}
+		service.Name = name
+		restart, _ := strconv.ParseBool(gctx.Query("restart"))
+		change, err := actor(gctx, controller).Modify(service, restart)
+		if err == controler.ErrNoDefinition {
+			gctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.IndentedJSON(http.StatusOK, change)
+	})
+	// uninstall service, ?archive=1 archives working directory, ?force=1 removes attached service
+	authOnly.DELETE("/service/:name", audited(auditLog, "remove"), verifyCSRF(), authorizeService(access, "remove", controler.RoleAdmin), func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		var options controler.RemoveOptions
+		options.Archive, _ = strconv.ParseBool(gctx.Query("archive"))
+		options.Force, _ = strconv.ParseBool(gctx.Query("force"))
+		archive, err := actor(gctx, controller).Remove(name, options)
+		if err == controler.ErrNotCreated {
+			gctx.AbortWithError(http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.IndentedJSON(http.StatusOK, gin.H{"archive": archive})
+	})
+	// regenerate unit from definition
+	authOnly.POST("/service/:name/reinstall", audited(auditLog, "reinstall"), verifyCSRF(), authorizeService(access, "reinstall", controler.RoleAdmin), func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		err := actor(gctx, controller).Reinstall(name)
+		if err == controler.ErrNoDefinition {
+			gctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.AbortWithStatus(http.StatusNoContent)
+	})
+	authOnly.GET("/events", authorize(access, "events", controler.RoleViewer), func(gctx *gin.Context) {
+		if history == nil {
+			gctx.AbortWithError(http.StatusNotFound, errors.New("events history disabled"))
+			return
+		}
+		filter, err := parseHistoryFilter(gctx, controller)
+		if err != nil {
+			gctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		page, err := history.Query(filter)
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		admin := roleOf(gctx, access, "") >= controler.RoleAdmin
+		for i, event := range page.Events {
+			page.Events[i] = visibleEvent(event, admin)
+		}
+		gctx.IndentedJSON(http.StatusOK, page)
+	})
+	authOnly.GET("/audit", authorize(access, "audit", controler.RoleAdmin), auditHandler(auditLog))
+	// --------------- tokens section
+	tokens := authOnly.Group("/tokens")
+	tokens.GET("/", listTokensHandler(access))
+	tokens.POST("/", audited(auditLog, "token-create"), verifyCSRF(), createTokenHandler(access))
+	tokens.DELETE("/:name", audited(auditLog, "token-revoke"), verifyCSRF(), revokeTokenHandler(access))
+	// --------------- config backups section
+	backups := authOnly.Group("/backups")
+	backups.GET("/", authorize(access, "backups", controler.RoleAdmin), func(gctx *gin.Context) {
+		list, err := controller.Backups()
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		gctx.IndentedJSON(http.StatusOK, list)
+	})
+	// restore config from backup by revision
+	backups.POST("/:name/restore", audited(auditLog, "restore"), verifyCSRF(), authorize(access, "restore", controler.RoleAdmin), func(gctx *gin.Context) {
+		err := actor(gctx, controller).Restore(gctx.Param("name"))
+		if err == controler.ErrUnknownBackup {
+			gctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
 		}
@@ -194,11 +404,11 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 	// --------------- groups section
 	groups := authOnly.Group("/group")
 	// all groups
-	groups.GET("/", func(gctx *gin.Context) {
+	groups.GET("/", authorize(access, "groups", controler.RoleViewer), func(gctx *gin.Context) {
 		gctx.IndentedJSON(http.StatusOK, controller.Groups())
 	})
 	// create group
-	groups.POST("/:name", func(gctx *gin.Context) {
+	groups.POST("/:name", audited(auditLog, "group"), verifyCSRF(), authorize(access, "group", controler.RoleAdmin), func(gctx *gin.Context) {
 		group := gctx.Param("name")
 		err := controller.Group(group)
 		if err != nil {
@@ -208,7 +418,7 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
 	// remove group
-	groups.DELETE("/:name", func(gctx *gin.Context) {
+	groups.DELETE("/:name", audited(auditLog, "ungroup"), verifyCSRF(), authorize(access, "ungroup", controler.RoleAdmin), func(gctx *gin.Context) {
 		group := gctx.Param("name")
 		err := controller.Ungroup(group)
 		if err != nil {
@@ -218,15 +428,15 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
 	// members of group
-	groups.GET("/:name", func(gctx *gin.Context) {
+	groups.GET("/:name", authorizeGroup(access, "groups", controler.RoleViewer), func(gctx *gin.Context) {
 		group := gctx.Param("name")
 		gctx.IndentedJSON(http.StatusOK, controller.Members(group))
 	})
 	// join service to group
-	groups.POST("/:name/:service", func(gctx *gin.Context) {
+	groups.POST("/:name/:service", audited(auditLog, "join"), verifyCSRF(), authorizeGroup(access, "join", controler.RoleAdmin), authorizeMember(access, "join", controler.RoleAdmin), func(gctx *gin.Context) {
 		group := gctx.Param("name")
 		service := gctx.Param("service")
-		err := controller.Join(group, service)
+		err := actor(gctx, controller).Join(group, service)
 		if err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
@@ -234,10 +444,10 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 		gctx.AbortWithStatus(http.StatusNoContent)
 	})
 	// leave service from group
-	groups.DELETE("/:name/:service", func(gctx *gin.Context) {
+	groups.DELETE("/:name/:service", audited(auditLog, "leave"), verifyCSRF(), authorizeGroup(access, "leave", controler.RoleAdmin), authorizeMember(access, "leave", controler.RoleAdmin), func(gctx *gin.Context) {
 		group := gctx.Param("name")
 		service := gctx.Param("service")
-		err := controller.Leave(group, service)
+		err := actor(gctx, controller).Leave(group, service)
 		if err != nil {
 			gctx.AbortWithError(http.StatusInternalServerError, err)
 			return
@@ -247,6 +457,73 @@ func NewHTTP(controller controler.ServiceController, access controler.Access, co
 	return router
 }
 
+// subscriber of events by websocket
+type subscriber struct {
+	conn  *websocket.Conn
+	admin bool
+}
+
+// visibleEvent hides user name, source and counter of failed login from non-admins
+func visibleEvent(event controler.SystemEvent, admin bool) controler.SystemEvent {
+	if admin || event.Type != controler.EventLoginFailed {
+		return event
+	}
+	event.Name = HiddenValue
+	event.Actor = HiddenValue
+	event.Details = HiddenValue
+	return event
+}
+
+// parseHistoryFilter reads events filter from query: service and group (both repeatable), type (repeatable),
+// from and to (RFC3339), offset and limit
+func parseHistoryFilter(gctx *gin.Context, controller controler.ServiceController) (controler.HistoryFilter, error) {
+	var filter controler.HistoryFilter
+	var err error
+	services, hasServices := gctx.GetQueryArray("service")
+	groups, hasGroups := gctx.GetQueryArray("group")
+	if hasServices || hasGroups {
+		filter.Services = append([]string{}, services...)
+		for _, group := range groups {
+			filter.Services = append(filter.Services, controller.Members(group)...)
+		}
+	}
+	for _, tp := range gctx.QueryArray("type") {
+		event, err := controler.ParseEvent(tp)
+		if err != nil {
+			return filter, err
+		}
+		filter.Types = append(filter.Types, event)
+	}
+	if v := gctx.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, err
+		}
+	}
+	if v := gctx.Query("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, err
+		}
+	}
+	if filter.Offset, err = strconv.Atoi(gctx.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		return filter, errors.New("invalid offset")
+	}
+	if filter.Limit, err = strconv.Atoi(gctx.DefaultQuery("limit", strconv.Itoa(DefaultEventsLimit))); err != nil || filter.Limit < 0 {
+		return filter, errors.New("invalid limit")
+	}
+	return filter, nil
+}
+
+// actor returns controller which acts on behalf of authenticated user
+func actor(gctx *gin.Context, controller controler.ServiceController) controler.ServiceController {
+	return controller.As(gctx.GetString(ContextUser), controler.OriginAPI)
+}
+
+// isFresh checks ?fresh=1 query parameter which forces live status query instead of cached one
+func isFresh(gctx *gin.Context) bool {
+	fresh, _ := strconv.ParseBool(gctx.Query("fresh"))
+	return fresh
+}
+
 func CORSMiddleware(cors CorsConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", cors.Origin)
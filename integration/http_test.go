@@ -0,0 +1,191 @@
+package integration
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sukauto/controler"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBackend keeps state of services in memory
+type fakeBackend struct {
+	lock    sync.Mutex
+	running map[string]bool
+}
+
+func (fb *fakeBackend) Control(name string, operation string, user bool) error {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	if fb.running == nil {
+		fb.running = make(map[string]bool)
+	}
+	switch operation {
+	case controler.RUN, controler.RESTART:
+		fb.running[name] = true
+	case controler.STOP:
+		fb.running[name] = false
+	}
+	return nil
+}
+
+func (fb *fakeBackend) Properties(name string, fields []string, user bool) (map[string]string, error) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+	state := controler.StateDead
+	if fb.running[name] {
+		state = controler.StateRunning
+	}
+	ans := make(map[string]string, len(fields))
+	for _, field := range fields {
+		ans[field] = ""
+	}
+	ans[controler.FieldStatus] = state
+	ans[controler.FieldLoadState] = "loaded"
+	return ans, nil
+}
+
+func (fb *fakeBackend) Log(name string, user bool) (string, error) {
+	return "", nil
+}
+
+type testServer struct {
+	handler    http.Handler
+	controller controler.AccessServiceController
+	auditLog   *controler.AuditLog
+	history    *controler.History
+	sessions   *Sessions
+	dir        string
+}
+
+// newTestServer serves API over controller with provided config. Passwords in config may be plaintext
+func newTestServer(t *testing.T, config string, guardConfig GuardConfig) *testServer {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	location := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(location, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	controller := controler.NewServiceControllerWithBackend(location, "true", &fakeBackend{})
+	return newTestServerWithAccess(t, controller, controller, guardConfig)
+}
+
+func newTestServerWithAccess(t *testing.T, controller controler.AccessServiceController, access controler.Access, guardConfig GuardConfig) *testServer {
+	dir, err := ioutil.TempDir("", "sukauto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if guardConfig.MaxAttempts == 0 {
+		guardConfig.MaxAttempts = 5
+		guardConfig.Lockout = time.Minute
+		guardConfig.MaxLockout = time.Hour
+	}
+	guard, err := guardConfig.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := NewSessions(SessionConfig{Lifetime: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLog := controler.NewAuditLog(filepath.Join(dir, controler.AuditFile), 0, 0)
+	history := controler.NewHistory(filepath.Join(dir, "history.jsonl"), 0, 0)
+	router := NewHTTP(controller, access, CorsConfig{}, controller.Events(), history, auditLog, sessions, guard)
+	return &testServer{handler: router, controller: controller, auditLog: auditLog, history: history, sessions: sessions, dir: dir}
+}
+
+func (ts *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	ts.handler.ServeHTTP(res, req)
+	return res
+}
+
+func basicAuth(req *http.Request, user, password string) *http.Request {
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+	return req
+}
+
+func lastAuditRecord(t *testing.T, ts *testServer) controler.AuditRecord {
+	page, err := ts.auditLog.Query(controler.AuditFilter{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) == 0 {
+		t.Fatal("no audit records")
+	}
+	return page.Records[0]
+}
+
+const testConfig = `{
+	"services": ["web", "db"],
+	"groups": {"frontend": ["web"]},
+	"users": {"admin": "admin-secret", "alice": "alice-secret", "bob": "bob-secret"},
+	"roles": {
+		"admin": {"role": "admin"},
+		"alice": {"role": "viewer", "groups": {"frontend": "operator"}}
+	}
+}`
+
+func TestAuditSource(t *testing.T) {
+	for _, trust := range []bool{false, true} {
+		ts := newTestServer(t, testConfig, GuardConfig{TrustProxy: trust})
+		req := basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/run/web", nil), "admin", "admin-secret")
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set("X-Forwarded-For", "10.1.2.3")
+		req.Header.Set("X-Real-Ip", "10.1.2.3")
+		if res := ts.serve(req); res.Code != http.StatusNoContent {
+			t.Fatal("unexpected status:", res.Code, res.Body.String())
+		}
+		record := lastAuditRecord(t, ts)
+		expected := "192.0.2.1"
+		if trust {
+			expected = "10.1.2.3"
+		}
+		if record.Source != expected || record.User != "admin" || record.Action != "run" || record.Target != "web" {
+			t.Error("unexpected audit record with trusted proxy", trust, ":", record)
+		}
+	}
+}
+
+// decodeJSON response body
+func decodeJSON(t *testing.T, res *httptest.ResponseRecorder, value interface{}) {
+	if err := json.Unmarshal(res.Body.Bytes(), value); err != nil {
+		t.Fatal("invalid response ", strings.TrimSpace(res.Body.String()), ": ", err)
+	}
+}
+
+func TestDefinitionEnvironment(t *testing.T) {
+	ts := newTestServer(t, `{
+		"services": ["web", "db"],
+		"groups": {"frontend": ["web"]},
+		"definitions": {"web": {"name": "web", "command": "/usr/bin/web", "work_dir": "/srv/web", "environment": {"DB_PASSWORD": "s3cret"}}},
+		"users": {"admin": "admin-secret", "alice": "alice-secret"},
+		"roles": {"admin": {"role": "admin"}, "alice": {"role": "viewer", "groups": {"frontend": "operator"}}}
+	}`, GuardConfig{})
+	for user, expected := range map[string]string{"admin": "s3cret", "alice": HiddenValue} {
+		res := ts.serve(basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/service/web", nil), user, user+"-secret"))
+		if res.Code != http.StatusOK {
+			t.Fatal(user, "unexpected status:", res.Code, res.Body.String())
+		}
+		var definition controler.NewService
+		decodeJSON(t, res, &definition)
+		if value := definition.Environment["DB_PASSWORD"]; value != expected {
+			t.Errorf("%s sees environment value %q", user, value)
+		}
+	}
+	// stored definition is not changed
+	if definition, _ := ts.controller.Definition("web"); definition.Environment["DB_PASSWORD"] != "s3cret" {
+		t.Error("stored environment is changed:", definition.Environment)
+	}
+}
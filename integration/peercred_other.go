@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package integration
+
+import (
+	"errors"
+	"net"
+)
+
+// peerCredentials are supported on linux only
+func peerCredentials(conn net.Conn) (Peer, error) {
+	return Peer{}, errors.New("peer credentials are not supported on this platform")
+}
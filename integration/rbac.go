@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"sukauto/controler"
+)
+
+// authorize is a middleware which requires global role of user for action
+func authorize(access controler.Access, action string, required controler.Role) gin.HandlerFunc {
+	mustBeTokenAction(action)
+	return func(gctx *gin.Context) {
+		permit(gctx, access, action, "", roleOf(gctx, access, ""), required, "")
+	}
+}
+
+// authorizeService is a middleware which requires role of user for action on service from name parameter
+func authorizeService(access controler.Access, action string, required controler.Role) gin.HandlerFunc {
+	mustBeTokenAction(action)
+	return func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("name")))
+		permit(gctx, access, action, name, roleOf(gctx, access, name), required, "service "+name)
+	}
+}
+
+// authorizeGroup is a middleware which requires role of user for action on group from name parameter
+func authorizeGroup(access controler.Access, action string, required controler.Role) gin.HandlerFunc {
+	mustBeTokenAction(action)
+	return func(gctx *gin.Context) {
+		group := gctx.Param("name")
+		role := controler.RoleAdmin
+		if !isRootPeer(gctx) {
+			role = access.GroupRole(gctx.GetString(ContextUser), group)
+		}
+		permit(gctx, access, action, "", role, required, "group "+group)
+	}
+}
+
+// authorizeMember is a middleware which requires role of user for action on service from service parameter,
+// so admin of group can't get roles on other services by joining them to the group
+func authorizeMember(access controler.Access, action string, required controler.Role) gin.HandlerFunc {
+	mustBeTokenAction(action)
+	return func(gctx *gin.Context) {
+		name := strings.ToLower(strings.TrimSpace(gctx.Param("service")))
+		permit(gctx, access, action, name, roleOf(gctx, access, name), required, "service "+name)
+	}
+}
+
+// mustBeTokenAction panics on action which can't be granted to tokens, so routes and tokens validation stay in sync
+func mustBeTokenAction(action string) {
+	for _, known := range controler.TokenActions {
+		if known == action {
+			return
+		}
+	}
+	panic("action " + action + " is not in token actions")
+}
+
+// requireViewer checks that authenticated user has at least viewer role
+func requireViewer(gctx *gin.Context, access controler.Access) {
+	user := gctx.GetString(ContextUser)
+	if role := roleOf(gctx, access, ""); role < controler.RoleViewer {
+		forbid(gctx, fmt.Sprintf("user %q has no role", user))
+	}
+}
+
+// roleOf authenticated user for service (empty name means global role). Root of the host connected
+// through unix socket is always an admin
+func roleOf(gctx *gin.Context, access controler.Access, service string) controler.Role {
+	if isRootPeer(gctx) {
+		return controler.RoleAdmin
+	}
+	return access.Role(gctx.GetString(ContextUser), service)
+}
+
+func isRootPeer(gctx *gin.Context) bool {
+	peer, ok := requestPeer(gctx)
+	return ok && peer.UID == 0
+}
+
+// permit aborts request by 403 with reason if role is not enough or action is out of token scope
+func permit(gctx *gin.Context, access controler.Access, action, service string, role, required controler.Role, scope string) {
+	if role < required {
+		reason := fmt.Sprintf("%s role required, user %q has %s role", required, gctx.GetString(ContextUser), role)
+		if scope != "" {
+			reason = fmt.Sprintf("%s role required for %s, user %q has %s role", required, scope, gctx.GetString(ContextUser), role)
+		}
+		forbid(gctx, reason)
+		return
+	}
+	if token, ok := requestToken(gctx); ok && !access.TokenAllows(token, action, service) {
+		reason := fmt.Sprintf("action %s is out of scope of token %q", action, token.Name)
+		if scope != "" {
+			reason = fmt.Sprintf("action %s on %s is out of scope of token %q", action, scope, token.Name)
+		}
+		forbid(gctx, reason)
+	}
+}
+
+// forbid aborts request by 403 with reason
+func forbid(gctx *gin.Context, reason string) {
+	gctx.Error(errors.New(reason))
+	gctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": reason})
+}
@@ -0,0 +1,244 @@
+package integration
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"strings"
+	"sukauto/controler"
+	"sync"
+	"time"
+)
+
+type SessionConfig struct {
+	Lifetime time.Duration `long:"lifetime" env:"LIFETIME" description:"Web session lifetime" default:"12h"`
+	Secret   string        `long:"secret" env:"SECRET" description:"Key to sign session cookies (random if not set)"`
+}
+
+type session struct {
+	User    string
+	Stamp   string // credentials of user on login, see Access.UserStamp
+	CSRF    string
+	Expires time.Time
+}
+
+// Sessions is an in-memory store of web sessions. Cookie value is session id signed by HMAC-SHA256
+type Sessions struct {
+	lifetime time.Duration
+	key      []byte
+	lock     sync.Mutex
+	sessions map[string]*session
+}
+
+func NewSessions(config SessionConfig) (*Sessions, error) {
+	key := []byte(config.Secret)
+	if len(key) == 0 {
+		var err error
+		if key, err = randomBytes(32); err != nil {
+			return nil, err
+		}
+	}
+	return &Sessions{lifetime: config.Lifetime, key: key, sessions: make(map[string]*session)}, nil
+}
+
+// Create session for user with stamp of its credentials and returns cookie value
+func (ss *Sessions) Create(user string, stamp string) (string, session, error) {
+	id, err := randomString()
+	if err != nil {
+		return "", session{}, err
+	}
+	csrf, err := randomString()
+	if err != nil {
+		return "", session{}, err
+	}
+	s := &session{User: user, Stamp: stamp, CSRF: csrf, Expires: time.Now().Add(ss.lifetime)}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	now := time.Now()
+	for k, v := range ss.sessions {
+		if v.Expires.Before(now) {
+			delete(ss.sessions, k)
+		}
+	}
+	ss.sessions[id] = s
+	return id + "." + ss.sign(id), *s, nil
+}
+
+// Get valid session by cookie value
+func (ss *Sessions) Get(cookie string) (session, bool) {
+	id, ok := ss.verify(cookie)
+	if !ok {
+		return session{}, false
+	}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	s, ok := ss.sessions[id]
+	if !ok {
+		return session{}, false
+	}
+	if s.Expires.Before(time.Now()) {
+		delete(ss.sessions, id)
+		return session{}, false
+	}
+	return *s, true
+}
+
+// Authenticate returns valid session by cookie value if user still exists with the same credentials.
+// Sessions of removed users or users with changed password are removed
+func (ss *Sessions) Authenticate(cookie string, access controler.Access) (session, bool) {
+	s, ok := ss.Get(cookie)
+	if !ok {
+		return session{}, false
+	}
+	if stamp, err := access.UserStamp(s.User); err != nil || stamp != s.Stamp {
+		ss.Remove(cookie)
+		return session{}, false
+	}
+	return s, true
+}
+
+// Remove session by cookie value
+func (ss *Sessions) Remove(cookie string) {
+	id, ok := ss.verify(cookie)
+	if !ok {
+		return
+	}
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	delete(ss.sessions, id)
+}
+
+func (ss *Sessions) verify(cookie string) (string, bool) {
+	parts := strings.SplitN(cookie, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(ss.sign(parts[0]))) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func (ss *Sessions) sign(id string) string {
+	mac := hmac.New(sha256.New, ss.key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type loginRequest struct {
+	User     string `json:"user" form:"user" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// loginHandler checks credentials and issues session and CSRF cookies. CSRF token is returned in response as well
+func loginHandler(access controler.Access, sessions *Sessions, guard *Guard) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		var request loginRequest
+		if err := gctx.ShouldBind(&request); err != nil {
+			gctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		if err := guard.login(gctx, access, request.User, request.Password); err != nil {
+			gctx.AbortWithError(statusOf(err), err)
+			return
+		}
+		stamp, err := access.UserStamp(request.User)
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		cookie, s, err := sessions.Create(request.User, stamp)
+		if err != nil {
+			gctx.AbortWithError(http.StatusInternalServerError, err)
+			return
+		}
+		secure := gctx.Request.TLS != nil
+		http.SetCookie(gctx.Writer, &http.Cookie{
+			Name:     SessionCookie,
+			Value:    cookie,
+			Path:     "/",
+			Expires:  s.Expires,
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteStrictMode,
+		})
+		// readable by scripts for double submit
+		http.SetCookie(gctx.Writer, &http.Cookie{
+			Name:     CSRFCookie,
+			Value:    s.CSRF,
+			Path:     "/",
+			Expires:  s.Expires,
+			Secure:   secure,
+			SameSite: http.SameSiteStrictMode,
+		})
+		gctx.IndentedJSON(http.StatusOK, gin.H{"user": s.User, "csrf_token": s.CSRF, "expires": s.Expires})
+	}
+}
+
+// logoutHandler removes session and clears cookies
+func logoutHandler(sessions *Sessions) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if cookie, err := gctx.Cookie(SessionCookie); err == nil {
+			sessions.Remove(cookie)
+		}
+		for _, name := range []string{SessionCookie, CSRFCookie} {
+			http.SetCookie(gctx.Writer, &http.Cookie{Name: name, Path: "/", MaxAge: -1})
+		}
+		gctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// verifyCSRF is a middleware which requires CSRF token header for requests authenticated by session
+func verifyCSRF() gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		s, ok := requestSession(gctx)
+		if !ok {
+			return
+		}
+		token := gctx.GetHeader(CSRFHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.CSRF)) != 1 {
+			forbid(gctx, "invalid CSRF token")
+		}
+	}
+}
+
+// verifyOrigin is a middleware which rejects cross-site websocket connections authenticated by session
+func verifyOrigin() gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if _, ok := requestSession(gctx); !ok {
+			return
+		}
+		origin, err := url.Parse(gctx.GetHeader("Origin"))
+		if err != nil || origin.Host != gctx.Request.Host {
+			forbid(gctx, "cross-origin request")
+		}
+	}
+}
+
+// requestSession returns web session used for request authentication
+func requestSession(gctx *gin.Context) (session, bool) {
+	value, ok := gctx.Get(ContextSession)
+	if !ok {
+		return session{}, false
+	}
+	s, ok := value.(session)
+	return s, ok
+}
+
+func randomBytes(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func randomString() (string, error) {
+	data, err := randomBytes(24)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
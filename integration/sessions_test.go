@@ -0,0 +1,120 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// login and returns session cookies and CSRF token
+func login(t *testing.T, ts *testServer, user, password string) ([]*http.Cookie, string) {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user": "`+user+`", "password": "`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := ts.serve(req)
+	if res.Code != http.StatusOK {
+		t.Fatal("login failed:", res.Code, res.Body.String())
+	}
+	var answer struct {
+		CSRF string `json:"csrf_token"`
+	}
+	decodeJSON(t, res, &answer)
+	cookies := res.Result().Cookies()
+	var session, csrf *http.Cookie
+	for _, cookie := range cookies {
+		switch cookie.Name {
+		case SessionCookie:
+			session = cookie
+		case CSRFCookie:
+			csrf = cookie
+		}
+	}
+	if session == nil || csrf == nil {
+		t.Fatal("session cookies are not issued:", cookies)
+	}
+	if !session.HttpOnly || session.SameSite != http.SameSiteStrictMode || csrf.HttpOnly {
+		t.Error("unexpected cookie attributes:", session, csrf)
+	}
+	if answer.CSRF == "" || answer.CSRF != csrf.Value {
+		t.Error("CSRF token in response differs from cookie:", answer.CSRF, csrf.Value)
+	}
+	return cookies, answer.CSRF
+}
+
+func withCookies(req *http.Request, cookies []*http.Cookie) *http.Request {
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestSessions(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"user": "admin", "password": "wrong"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if res := ts.serve(req); res.Code != http.StatusUnauthorized || len(res.Result().Cookies()) != 0 {
+		t.Error("login with wrong password:", res.Code, res.Result().Cookies())
+	}
+
+	cookies, csrf := login(t, ts, "admin", "admin-secret")
+	if res := ts.serve(withCookies(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), cookies)); res.Code != http.StatusOK {
+		t.Error("session is not accepted:", res.Code, res.Body.String())
+	}
+
+	// mutating requests require CSRF token
+	res := ts.serve(withCookies(httptest.NewRequest(http.MethodGet, "/monitor/run/web", nil), cookies))
+	if res.Code != http.StatusForbidden {
+		t.Error("request without CSRF token:", res.Code)
+	}
+	req = withCookies(httptest.NewRequest(http.MethodGet, "/monitor/run/web", nil), cookies)
+	req.Header.Set(CSRFHeader, csrf+"x")
+	if res := ts.serve(req); res.Code != http.StatusForbidden {
+		t.Error("request with invalid CSRF token:", res.Code)
+	}
+	req = withCookies(httptest.NewRequest(http.MethodGet, "/monitor/run/web", nil), cookies)
+	req.Header.Set(CSRFHeader, csrf)
+	if res := ts.serve(req); res.Code != http.StatusNoContent {
+		t.Error("request with CSRF token:", res.Code, res.Body.String())
+	}
+	// Basic auth needs no CSRF token
+	if res := ts.serve(basicAuth(httptest.NewRequest(http.MethodGet, "/monitor/stop/web", nil), "admin", "admin-secret")); res.Code != http.StatusNoContent {
+		t.Error("Basic auth request:", res.Code, res.Body.String())
+	}
+
+	res = ts.serve(withCookies(httptest.NewRequest(http.MethodPost, "/logout", nil), cookies))
+	if res.Code != http.StatusNoContent {
+		t.Fatal("logout failed:", res.Code)
+	}
+	for _, cookie := range res.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Error("cookie is not cleared:", cookie)
+		}
+	}
+	if res := ts.serve(withCookies(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), cookies)); res.Code != http.StatusUnauthorized {
+		t.Error("session is valid after logout:", res.Code)
+	}
+}
+
+func TestSessionsInvalidatedByUserChanges(t *testing.T) {
+	ts := newTestServer(t, testConfig, GuardConfig{})
+	alice, _ := login(t, ts, "alice", "alice-secret")
+	bob, _ := login(t, ts, "bob", "bob-secret")
+	admin, _ := login(t, ts, "admin", "admin-secret")
+
+	if err := ts.controller.SetPassword("alice", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.controller.RemoveUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	for user, cookies := range map[string][]*http.Cookie{"alice": alice, "bob": bob} {
+		if res := ts.serve(withCookies(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), cookies)); res.Code != http.StatusUnauthorized {
+			t.Error("session of", user, "is valid after change of user:", res.Code)
+		}
+	}
+	if res := ts.serve(withCookies(httptest.NewRequest(http.MethodGet, "/monitor/status", nil), admin)); res.Code != http.StatusOK {
+		t.Error("session of unchanged user is invalidated:", res.Code)
+	}
+	login(t, ts, "alice", "changed")
+}
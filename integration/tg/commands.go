@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 	"sukauto/controler"
+	"time"
 )
 
 type tgFunc func(system controler.ServiceController, text string) (string, error)
@@ -32,13 +33,12 @@ func tgNonEmpty(fn tgFunc) tgFunc {
 var commands = map[string]tgFunc{
 	"status": func(system controler.ServiceController, name string) (s string, e error) {
 		if name != "" {
-			status := system.Status(name)
-			return statusEmoji[status.Status] + " " + name + " is " + status.Status, nil
+			return describeStatus(system.Status(name)), nil
 		}
 		all := system.RefreshStatus()
 		var parts []string
 		for _, srv := range all.Services {
-			parts = append(parts, fmt.Sprintf("%v %v is %v", statusEmoji[srv.Status], srv.Name, srv.Status))
+			parts = append(parts, describeStatus(srv))
 		}
 		return strings.Join(parts, "\n"), nil
 	},
@@ -56,6 +56,40 @@ var commands = map[string]tgFunc{
 	}),
 }
 
+// read-only commands are not recorded to audit log
+var readOnlyCommands = map[string]bool{
+	"status": true,
+	"help":   true,
+}
+
+// describeStatus formats status like: ⚙ web is running (enabled, up 1h0m0s, pid 1234, 2 restarts, 10.0 MiB)
+func describeStatus(status controler.ServiceStatus) string {
+	var details []string
+	if status.UnitFileState != "" {
+		details = append(details, status.UnitFileState)
+	}
+	if status.Uptime > 0 {
+		details = append(details, "up "+(time.Duration(status.Uptime)*time.Second).String())
+	}
+	if status.MainPID > 0 {
+		details = append(details, fmt.Sprintf("pid %d", status.MainPID))
+	}
+	if status.Restarts > 0 {
+		details = append(details, fmt.Sprintf("%d restarts", status.Restarts))
+	}
+	if status.ExitCode != 0 {
+		details = append(details, fmt.Sprintf("exit code %d", status.ExitCode))
+	}
+	if status.Memory > 0 {
+		details = append(details, fmt.Sprintf("%.1f MiB", float64(status.Memory)/(1<<20)))
+	}
+	text := fmt.Sprintf("%v %v is %v", statusEmoji[status.Status], status.Name, status.Status)
+	if len(details) > 0 {
+		text += " (" + strings.Join(details, ", ") + ")"
+	}
+	return text
+}
+
 func init() {
 	commands["help"] = func(system controler.ServiceController, text string) (s string, e error) {
 		var names []string
@@ -3,16 +3,18 @@ package tg
 import "sukauto/controler"
 
 var eventEmoji = map[controler.Event]string{
-	controler.EventCreated:   "\u2795",
-	controler.EventRemoved:   "🗑️",
-	controler.EventStarted:   "👌",
-	controler.EventRestarted: "♻️",
-	controler.EventStopped:   "✋",
-	controler.EventUpdated:   "✔️",
-	controler.EventEnabled:   "☑️",
-	controler.EventDisabled:  "⛔",
-	controler.EventJoined:    "\u26D3",
-	controler.EventLeaved:    "❗",
+	controler.EventCreated:     "\u2795",
+	controler.EventRemoved:     "🗑️",
+	controler.EventStarted:     "👌",
+	controler.EventRestarted:   "♻️",
+	controler.EventStopped:     "✋",
+	controler.EventUpdated:     "✔️",
+	controler.EventEnabled:     "☑️",
+	controler.EventDisabled:    "⛔",
+	controler.EventJoined:      "\u26D3",
+	controler.EventLeaved:      "❗",
+	controler.EventLoginFailed: "🚨",
+	controler.EventModified:    "✏️",
 }
 
 var statusEmoji = map[string]string{
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -22,7 +23,7 @@ type ExtraTelegram struct {
 	Admins   []int64 `long:"admins" env:"ADMINS" description:"Administrator user ID" env-delim:","`
 }
 
-func (et ExtraTelegram) Run(system controler.ServiceController, events <-chan controler.SystemEvent) error {
+func (et ExtraTelegram) Run(system controler.AccessServiceController, events <-chan controler.SystemEvent, auditLog *controler.AuditLog, attempts *controler.LoginGuard) error {
 	if !et.Enable {
 		return nil
 	}
@@ -30,7 +31,7 @@ func (et ExtraTelegram) Run(system controler.ServiceController, events <-chan co
 	if err != nil {
 		return err
 	}
-	go et.listenCommands(system)
+	go et.listenCommands(system, auditLog, attempts)
 	for event := range events {
 		if err := et.sendEvent(event, tpl); err != nil {
 			log.Println("[ERROR]", "sendEvent to telegram:", err)
@@ -76,7 +77,7 @@ func (et *ExtraTelegram) sendTo(chatID int64, text string) error {
 	return nil
 }
 
-func (et *ExtraTelegram) listenCommands(system controler.ServiceController) {
+func (et *ExtraTelegram) listenCommands(system controler.AccessServiceController, auditLog *controler.AuditLog, attempts *controler.LoginGuard) {
 	var offset int64
 	for {
 		for _, upd := range et.getUpdates(offset) {
@@ -100,9 +101,6 @@ func (et *ExtraTelegram) listenCommands(system controler.ServiceController) {
 					break
 				}
 			}
-			if !isAdmin {
-				continue
-			}
 
 			parts := strings.SplitN(upd.Message.Text, " ", 2)
 			cmd := parts[0]
@@ -115,7 +113,19 @@ func (et *ExtraTelegram) listenCommands(system controler.ServiceController) {
 			if !ok {
 				continue
 			}
-			reply, err := h(system, text)
+			user := strconv.FormatInt(upd.Message.From.ID, 10)
+			if !isAdmin {
+				key := "tg:" + user
+				if attempts.Locked(key) > 0 {
+					continue
+				}
+				failures := attempts.Fail(key)
+				system.LoginFailed(user, controler.OriginTelegram, fmt.Sprintf("command %s in chat %d, %d failures in a row", cmd, upd.Chat.ID, failures))
+				et.audit(auditLog, user, upd.Chat.ID, cmd, text, errDenied)
+				continue
+			}
+			reply, err := h(system.As(user, controler.OriginTelegram), text)
+			et.audit(auditLog, user, upd.Chat.ID, cmd, text, err)
 			if err != nil {
 				err = et.sendTo(upd.Chat.ID, "⚠️ "+err.Error())
 			} else if reply != "" {
@@ -128,6 +138,34 @@ func (et *ExtraTelegram) listenCommands(system controler.ServiceController) {
 	}
 }
 
+var errDenied = errors.New("user is not an administrator")
+
+// audit records mutating command to audit log
+func (et *ExtraTelegram) audit(auditLog *controler.AuditLog, user string, chatID int64, cmd, target string, err error) {
+	if auditLog == nil || readOnlyCommands[cmd] {
+		return
+	}
+	record := controler.AuditRecord{
+		Time:   time.Now(),
+		User:   user,
+		Source: strconv.FormatInt(chatID, 10),
+		Action: cmd,
+		Target: target,
+		Result: controler.AuditOK,
+	}
+	if err == errDenied {
+		record.Result = controler.AuditDenied
+	} else if err != nil {
+		record.Result = controler.AuditError
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := auditLog.Record(record); err != nil {
+		log.Println("[ERROR]", "failed to write audit record:", err)
+	}
+}
+
 type tgUpdate struct {
 	ID   int64 `json:"update_id"`
 	Chat struct {
@@ -0,0 +1,121 @@
+package integration
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+type TLSConfig struct {
+	Cert           string `long:"tls-cert" env:"TLS_CERT" description:"TLS certificate file (PEM)"`
+	Key            string `long:"tls-key" env:"TLS_KEY" description:"TLS private key file (PEM)"`
+	SelfSigned     bool   `long:"tls-self-signed" env:"TLS_SELF_SIGNED" description:"Generate self-signed certificate (saved to tls-cert and tls-key if set and not exist)"`
+	ClientCA       string `long:"tls-client-ca" env:"TLS_CLIENT_CA" description:"CA bundle (PEM) to verify client certificates. Certificate CN is mapped to user"`
+	ClientRequired bool   `long:"tls-client-required" env:"TLS_CLIENT_REQUIRED" description:"Reject clients without valid certificate"`
+}
+
+// Server TLS configuration or nil if TLS is not enabled
+func (tc TLSConfig) Server() (*tls.Config, error) {
+	if !tc.SelfSigned && tc.Cert == "" && tc.Key == "" {
+		if tc.ClientCA != "" {
+			return nil, errors.New("client certificates require TLS")
+		}
+		return nil, nil
+	}
+	cert, err := tc.certificate()
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if tc.ClientCA != "" {
+		bundle, err := ioutil.ReadFile(tc.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("no certificates in client CA bundle")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if tc.ClientRequired {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config, nil
+}
+
+func (tc TLSConfig) certificate() (tls.Certificate, error) {
+	if !tc.SelfSigned {
+		return tls.LoadX509KeyPair(tc.Cert, tc.Key)
+	}
+	if tc.Cert != "" && tc.Key != "" {
+		if _, err := os.Stat(tc.Cert); err == nil {
+			return tls.LoadX509KeyPair(tc.Cert, tc.Key)
+		}
+	}
+	certPEM, keyPEM, err := generateCertificate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if tc.Cert != "" && tc.Key != "" {
+		if err := ioutil.WriteFile(tc.Key, keyPEM, 0600); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := ioutil.WriteFile(tc.Cert, certPEM, 0644); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateCertificate creates self-signed certificate for host name, localhost and loopback addresses
+func generateCertificate() (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "sukauto", Organization: []string{"sukauto"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sukauto/controler"
+	"time"
+)
+
+type tokenRequest struct {
+	Name     string     `json:"name" binding:"required"`
+	Expires  *time.Time `json:"expires"` // RFC3339, optional
+	Services []string   `json:"services"`
+	Groups   []string   `json:"groups"`
+	Actions  []string   `json:"actions" binding:"required"`
+}
+
+// createTokenHandler creates token owned by current user and returns its secret once
+func createTokenHandler(access controler.Access) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if !denyToken(gctx) {
+			return
+		}
+		var request tokenRequest
+		if err := gctx.BindJSON(&request); err != nil {
+			return
+		}
+		gctx.Set(ContextTarget, request.Name)
+		token := controler.Token{
+			Name:     request.Name,
+			Owner:    gctx.GetString(ContextUser),
+			Expires:  request.Expires,
+			Services: request.Services,
+			Groups:   request.Groups,
+			Actions:  request.Actions,
+		}
+		secret, err := access.CreateToken(token)
+		if err != nil {
+			gctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		gctx.IndentedJSON(http.StatusCreated, gin.H{"name": token.Name, "token": secret})
+	}
+}
+
+// listTokensHandler lists tokens of current user or all tokens for admin
+func listTokensHandler(access controler.Access) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if !denyToken(gctx) {
+			return
+		}
+		user := gctx.GetString(ContextUser)
+		admin := roleOf(gctx, access, "") >= controler.RoleAdmin
+		ans := make([]controler.Token, 0)
+		for _, token := range access.ListTokens() {
+			if admin || token.Owner == user {
+				ans = append(ans, token)
+			}
+		}
+		gctx.IndentedJSON(http.StatusOK, ans)
+	}
+}
+
+// revokeTokenHandler revokes own token (or any token for admin)
+func revokeTokenHandler(access controler.Access) gin.HandlerFunc {
+	return func(gctx *gin.Context) {
+		if !denyToken(gctx) {
+			return
+		}
+		name := gctx.Param("name")
+		user := gctx.GetString(ContextUser)
+		if roleOf(gctx, access, "") < controler.RoleAdmin {
+			var owned bool
+			for _, token := range access.ListTokens() {
+				owned = owned || (token.Name == name && token.Owner == user)
+			}
+			if !owned {
+				forbid(gctx, "only owner or admin can revoke token")
+				return
+			}
+		}
+		if err := access.RevokeToken(name); err != nil {
+			gctx.AbortWithError(http.StatusNotFound, err)
+			return
+		}
+		gctx.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// denyToken forbids tokens management by token. Returns true if request is authenticated by password
+func denyToken(gctx *gin.Context) bool {
+	if _, ok := requestToken(gctx); ok {
+		forbid(gctx, "tokens can't be managed by token")
+		return false
+	}
+	return true
+}
+
+// requestToken returns API token used for request authentication
+func requestToken(gctx *gin.Context) (controler.Token, bool) {
+	value, ok := gctx.Get(ContextToken)
+	if !ok {
+		return controler.Token{}, false
+	}
+	token, ok := value.(controler.Token)
+	return token, ok
+}
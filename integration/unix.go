@@ -0,0 +1,71 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+type UnixConfig struct {
+	Socket string `long:"socket" env:"SOCKET" description:"Unix socket for local clients authenticated by uid (empty - disabled)"`
+	Mode   string `long:"socket-mode" env:"SOCKET_MODE" description:"Permissions of unix socket" default:"0660"`
+}
+
+// Peer is a credential of process connected to unix socket
+type Peer struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+type peerKey struct{}
+
+// Serve handler on unix socket. Stale socket file of previous run is removed
+func (uc UnixConfig) Serve(handler http.Handler) error {
+	mode, err := strconv.ParseUint(uc.Mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("socket mode: %v", err)
+	}
+	if err := os.Remove(uc.Socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", uc.Socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(uc.Socket, os.FileMode(mode)); err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			peer, err := peerCredentials(conn)
+			if err != nil {
+				log.Println("unix socket: failed to get peer credentials:", err)
+				return ctx
+			}
+			return context.WithValue(ctx, peerKey{}, peer)
+		},
+	}
+	return server.Serve(listener)
+}
+
+// requestPeer returns credentials of client if request came through unix socket
+func requestPeer(gctx *gin.Context) (Peer, bool) {
+	peer, ok := gctx.Request.Context().Value(peerKey{}).(Peer)
+	return peer, ok
+}
+
+// clientSource is an address of client for logs and audit
+func clientSource(gctx *gin.Context) string {
+	if peer, ok := requestPeer(gctx); ok {
+		return fmt.Sprintf("unix:uid=%d,pid=%d", peer.UID, peer.PID)
+	}
+	return gctx.ClientIP()
+}
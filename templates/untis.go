@@ -11,7 +11,7 @@ Description={{.Name}}
 Environment={{$k}}={{$v}}
 {{- end}}
 ExecStart={{.Command}}
-Restart=always
+Restart={{or .Restart "always"}}
 RestartSec=5
 {{- with .WorkingDirectory}}
 WorkingDirectory={{.}}